@@ -50,14 +50,18 @@ func (s *ServiceConf) register(fn func(*api.AgentServiceRegistration) error) (er
 }
 
 func newAgent(c *AgentConf) (agent *api.Agent, err error) {
-	config := api.DefaultConfig()
-	if c != nil {
-		config.Address = c.Address
-	}
-	client, err := api.NewClient(config)
+	client, err := newClient(c)
 	if err != nil {
 		return
 	}
 	agent = client.Agent()
 	return
 }
+
+func newClient(c *AgentConf) (*api.Client, error) {
+	config := api.DefaultConfig()
+	if c != nil {
+		config.Address = c.Address
+	}
+	return api.NewClient(config)
+}
@@ -0,0 +1,130 @@
+package consul
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// WatchConf for healthy service instances
+type WatchConf struct {
+	// Name of service
+	Name string
+	// Tags all required on an instance
+	Tags []string
+	// Datacenter to query, default is the agent's
+	Datacenter string
+	// WaitTime for a blocking query
+	WaitTime time.Duration
+	// Agent config for consul
+	Agent *AgentConf
+}
+
+// Instance of a healthy service
+type Instance struct {
+	// ID of service instance
+	ID string
+	// Address of service instance
+	Address string
+	// Port of service instance
+	Port int
+	// Tags of service instance
+	Tags []string
+	// Meta of service instance
+	Meta map[string]string
+}
+
+const (
+	defaultWaitTime   = 5 * time.Minute
+	minWatchRetryWait = time.Second
+	maxWatchRetryWait = 30 * time.Second
+)
+
+// HostPort of the instance
+func (i *Instance) HostPort() string {
+	return i.Address + ":" + strconv.FormatInt(int64(i.Port), 10)
+}
+
+// Instances returns the passing instances, waiting for a change after index if index is not 0
+func (c *WatchConf) Instances(ctx context.Context, index uint64) (ins []*Instance, lastIndex uint64, err error) {
+	client, err := newClient(c.Agent)
+	if err != nil {
+		return
+	}
+	return c.instances(ctx, client, index)
+}
+
+func (c *WatchConf) instances(ctx context.Context, client *api.Client, index uint64) (ins []*Instance, lastIndex uint64, err error) {
+	wt := c.WaitTime
+	if wt <= 0 {
+		wt = defaultWaitTime
+	}
+	q := &api.QueryOptions{
+		Datacenter: c.Datacenter,
+		WaitIndex:  index,
+		WaitTime:   wt,
+	}
+	entries, meta, err := client.Health().ServiceMultipleTags(c.Name, c.Tags, true, q.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	ins = make([]*Instance, 0, len(entries))
+	for _, e := range entries {
+		addr := e.Service.Address
+		if addr == "" {
+			addr = e.Node.Address
+		}
+		ins = append(ins, &Instance{
+			ID:      e.Service.ID,
+			Address: addr,
+			Port:    e.Service.Port,
+			Tags:    e.Service.Tags,
+			Meta:    e.Service.Meta,
+		})
+	}
+	lastIndex = meta.LastIndex
+	return
+}
+
+// Watch the passing instances with blocking queries until ctx is done,
+// fn is called with the instances on every change, or with the error on failure
+func (c *WatchConf) Watch(ctx context.Context, fn func(ins []*Instance, err error)) {
+	client, err := newClient(c.Agent)
+	if err != nil {
+		fn(nil, err)
+		return
+	}
+	var index uint64
+	wait := minWatchRetryWait
+	for ctx.Err() == nil {
+		ins, last, err := c.instances(ctx, client, index)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fn(nil, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			if wait *= 2; wait > maxWatchRetryWait {
+				wait = maxWatchRetryWait
+			}
+			continue
+		}
+		wait = minWatchRetryWait
+		// index went backwards, the raft state may be reset
+		if last < index {
+			index = 0
+			continue
+		}
+		if last == index {
+			continue
+		}
+		index = last
+		fn(ins, nil)
+	}
+}
@@ -4,7 +4,9 @@ package controller
 type CtrlCommand struct {
 	// Command currently can be one of CommandShutdown and CommandRestart
 	Command int
-	// ErrCh if not nil can be used to receive the error
+	// ErrCh if not nil can be used to receive the error,
+	// a *RestartError for CommandRestart, HookErrors for CommandShutdown,
+	// which is dropped if not received when the servers are shutdown
 	ErrCh chan error
 }
 
@@ -15,5 +17,5 @@ const (
 	CommandRestart
 )
 
-// CommandCh is the "command channel"
-var CommandCh chan CtrlCommand
+// CommandCh is the "command channel" of the default manager
+var CommandCh = defaultManager.CommandCh
@@ -29,8 +29,13 @@ func (s *controlServer) Shutdown(ctx context.Context) error {
 	return s.server.Shutdown(ctx)
 }
 
-// NewControlServer creates a control command server
+// NewControlServer creates a control command server of the default manager
 func NewControlServer() Server {
+	return defaultManager.NewControlServer()
+}
+
+// NewControlServer creates a control command server of the manager
+func (m *Manager) NewControlServer() Server {
 	h := func(writer http.ResponseWriter, request *http.Request) {
 		var err error
 		defer func() {
@@ -43,10 +48,10 @@ func NewControlServer() Server {
 		var response commandResponse
 		switch request.RequestURI {
 		case "/shutdown":
-			CommandCh <- CtrlCommand{Command: CommandShutdown}
+			m.CommandCh <- CtrlCommand{Command: CommandShutdown}
 		case "/restart":
 			cmd := CtrlCommand{Command: CommandRestart, ErrCh: make(chan error)}
-			CommandCh <- cmd
+			m.CommandCh <- cmd
 			if e := <-cmd.ErrCh; e != nil {
 				response.Err = e.Error()
 			}
@@ -69,11 +74,11 @@ func NewControlServer() Server {
 		_, err = writer.Write(data)
 	}
 
-	m := http.NewServeMux()
-	m.HandleFunc("/", h)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", h)
 	return &controlServer{
 		server: &http.Server{
-			Handler: m,
+			Handler: mux,
 		},
 	}
 }
@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Stage of the lifecycle to run hooks
+type Stage int
+
+const (
+	// PreStart before listening, a failure stops running
+	PreStart Stage = iota
+	// PostStart after the servers start serving
+	PostStart
+	// PreShutdown before the servers drain, like deregistering from discovery
+	PreShutdown
+	// PostShutdown after the servers shutdown, like flushing logs and closing pools
+	PostShutdown
+)
+
+var stageNames = [...]string{"pre-start", "post-start", "pre-shutdown", "post-shutdown"}
+
+// String implements Stringer
+func (s Stage) String() string {
+	if s < 0 || int(s) >= len(stageNames) {
+		return fmt.Sprintf("stage(%d)", int(s))
+	}
+	return stageNames[s]
+}
+
+// Hook runs at a stage of the lifecycle, hooks of a stage run in the added order
+type Hook struct {
+	// Name of the hook, for logs and errors
+	Name string
+	// Stage to run at
+	Stage Stage
+	// Timeout of the hook, no timeout if 0
+	Timeout time.Duration
+	// Fn of the hook, should return when ctx is done
+	Fn func(ctx context.Context) error
+}
+
+// HookError of a failed hook
+type HookError struct {
+	Name  string
+	Stage Stage
+	Err   error
+}
+
+// Error implements error
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%s hook %s: %v", e.Stage, e.Name, e.Err)
+}
+
+// Unwrap the error of the hook
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// HookErrors of the failed hooks of a run
+type HookErrors []*HookError
+
+// Error implements error
+func (es HookErrors) Error() string {
+	s := make([]string, len(es))
+	for i, e := range es {
+		s[i] = e.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// err returns nil if no hook failed
+func (es HookErrors) err() error {
+	if len(es) <= 0 {
+		return nil
+	}
+	return es
+}
+
+// AddHook to the default manager
+func AddHook(h Hook) {
+	defaultManager.AddHook(h)
+}
+
+// SetDrainDelay of the default manager
+func SetDrainDelay(d time.Duration) {
+	defaultManager.SetDrainDelay(d)
+}
+
+// AddHook to the manager, hooks added after the stage has run are not run
+func (m *Manager) AddHook(h Hook) {
+	m.lock.Lock()
+	m.hooks = append(m.hooks, h)
+	m.lock.Unlock()
+}
+
+// SetDrainDelay between draining the servers and shutting them down,
+// for load balancers to notice the failing health checks, it is within the shutdown wait
+func (m *Manager) SetDrainDelay(d time.Duration) {
+	m.lock.Lock()
+	m.drainDelay = d
+	m.lock.Unlock()
+}
+
+// runHooks of the stage in order, failures are logged and returned
+func (m *Manager) runHooks(stage Stage) (errs HookErrors) {
+	m.lock.Lock()
+	hooks := make([]Hook, 0, len(m.hooks))
+	for _, h := range m.hooks {
+		if h.Stage == stage {
+			hooks = append(hooks, h)
+		}
+	}
+	m.lock.Unlock()
+
+	for _, h := range hooks {
+		if err := runHook(h); err != nil {
+			e := &HookError{Name: h.Name, Stage: stage, Err: err}
+			log.Printf("%v", e)
+			errs = append(errs, e)
+		}
+	}
+	return
+}
+
+// runHook with the timeout, returns when timeout even if the hook is still running
+func runHook(h Hook) error {
+	ctx := context.Background()
+	if h.Timeout <= 0 {
+		return h.Fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+	ch := make(chan error, 1)
+	go func() {
+		ch <- h.Fn(ctx)
+	}()
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
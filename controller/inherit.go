@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// inheritedListener passed to the child in the env, matched by network and address
+type inheritedListener struct {
+	Network string `json:"network"`
+	Address string `json:"address"`
+	Fd      int    `json:"fd"`
+}
+
+var (
+	// inheritedFiles by the listener name
+	inheritedFiles = map[string]*os.File{}
+	// positionalFiles from a parent only passing the count of fds
+	positionalFiles []*os.File
+	inheritedMtx    sync.Mutex
+)
+
+func listenerName(network, address string) string {
+	return network + "://" + address
+}
+
+// parseInherited files from the env value, a json list of listeners or the count of fds
+func parseInherited(v string) error {
+	if cnt, err := strconv.ParseInt(v, 10, 64); err == nil {
+		positionalFiles = make([]*os.File, cnt)
+		for i := 0; i < int(cnt); i++ {
+			positionalFiles[i] = os.NewFile(uintptr(3+i), "")
+		}
+		return nil
+	}
+	var ls []inheritedListener
+	if err := json.Unmarshal([]byte(v), &ls); err != nil {
+		return err
+	}
+	for _, l := range ls {
+		name := listenerName(l.Network, l.Address)
+		inheritedFiles[name] = os.NewFile(uintptr(l.Fd), name)
+	}
+	return nil
+}
+
+// encodeInherited listeners for the child, the fd of names[i] is 3+i
+func encodeInherited(names [][2]string) (string, error) {
+	ls := make([]inheritedListener, len(names))
+	for i, n := range names {
+		ls[i] = inheritedListener{Network: n[0], Address: n[1], Fd: 3 + i}
+	}
+	data, err := json.Marshal(ls)
+	return string(data), err
+}
+
+// takeInherited file of the listener, idx is used for a positional parent, nil if not inherited
+func takeInherited(network, address string, idx int) *os.File {
+	inheritedMtx.Lock()
+	defer inheritedMtx.Unlock()
+	name := listenerName(network, address)
+	if f, ok := inheritedFiles[name]; ok {
+		delete(inheritedFiles, name)
+		return f
+	}
+	if idx < len(positionalFiles) && positionalFiles[idx] != nil {
+		f := positionalFiles[idx]
+		positionalFiles[idx] = nil
+		return f
+	}
+	return nil
+}
+
+// closeInherited files not taken, the servers of them are removed in this version
+func closeInherited() {
+	inheritedMtx.Lock()
+	defer inheritedMtx.Unlock()
+	for name, f := range inheritedFiles {
+		log.Printf("close unused inherited listener %s", name)
+		_ = f.Close()
+		delete(inheritedFiles, name)
+	}
+	for i, f := range positionalFiles {
+		if f != nil {
+			log.Printf("close unused inherited listener %d", i)
+			_ = f.Close()
+		}
+	}
+	positionalFiles = nil
+}
+
+// inheritedError of an inherited file failed to be a listener
+func inheritedError(network, address string, err error) error {
+	return fmt.Errorf("inherited listener %s: %w", listenerName(network, address), err)
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInherited(t *testing.T) {
+	require := require.New(t)
+	l1, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l1.Close()
+	l2, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l2.Close()
+	fd := func(l net.Listener) string {
+		f, err := l.(*net.TCPListener).File()
+		require.NoError(err)
+		defer f.Close()
+		// owned by the inherited file
+		d, err := syscall.Dup(int(f.Fd()))
+		require.NoError(err)
+		return strconv.Itoa(d)
+	}
+
+	// fds of the files instead of 3+i in a child
+	v, err := encodeInherited([][2]string{{"tcp", ":8080"}, {"tcp", ":9090"}})
+	require.NoError(err)
+	require.Equal(`[{"network":"tcp","address":":8080","fd":3},{"network":"tcp","address":":9090","fd":4}]`, v)
+	v = `[{"network":"tcp","address":":8080","fd":` + fd(l1) + `},{"network":"tcp","address":":9090","fd":` + fd(l2) + `}]`
+	require.NoError(parseInherited(v))
+	defer closeInherited()
+
+	// matched by name regardless of the order
+	f := takeInherited("tcp", ":9090", 0)
+	require.NotNil(f)
+	l, err := net.FileListener(f)
+	require.NoError(err)
+	require.Equal(l2.Addr().String(), l.Addr().String())
+	require.NoError(l.Close())
+	require.NoError(f.Close())
+
+	require.Nil(takeInherited("tcp", ":7070", 1))
+	require.Nil(takeInherited("tcp", ":9090", 1))
+
+	closeInherited()
+	require.Nil(takeInherited("tcp", ":8080", 0))
+}
+
+func TestInherited_Managers(t *testing.T) {
+	require := require.New(t)
+	var ls []net.Listener
+	var fds []string
+	for i := 0; i < 3; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(err)
+		defer l.Close()
+		f, err := l.(*net.TCPListener).File()
+		require.NoError(err)
+		// owned by the inherited file
+		d, err := syscall.Dup(int(f.Fd()))
+		require.NoError(err)
+		require.NoError(f.Close())
+		fds = append(fds, strconv.Itoa(d))
+		ls = append(ls, l)
+	}
+	isGraceful = true
+	defer func() { isGraceful = false }()
+	require.NoError(parseInherited(`[{"network":"tcp","address":":8080","fd":` + fds[0] +
+		`},{"network":"tcp","address":":9090","fd":` + fds[1] +
+		`},{"network":"tcp","address":":7070","fd":` + fds[2] + `}]`))
+	defer closeInherited()
+
+	m1, m2 := NewManager(), NewManager()
+	require.NoError(m1.AddServer("tcp", ":8080", newTestServer()))
+	require.NoError(m2.AddServer("tcp", ":9090", newTestServer()))
+	defer unregister(m1)
+	defer unregister(m2)
+
+	// kept for the other manager
+	require.NoError(m1.listen())
+	defer m1.closeListeners()
+	inheritedMtx.Lock()
+	require.Len(inheritedFiles, 2)
+	inheritedMtx.Unlock()
+
+	// the unused one is closed after all managers listened
+	require.NoError(m2.listen())
+	defer m2.closeListeners()
+	require.Equal(ls[0].Addr().String(), m1.servers[0].listener.Addr().String())
+	require.Equal(ls[1].Addr().String(), m2.servers[0].listener.Addr().String())
+	inheritedMtx.Lock()
+	require.Len(inheritedFiles, 0)
+	inheritedMtx.Unlock()
+}
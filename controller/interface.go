@@ -16,3 +16,12 @@ type Server interface {
 	 */
 	Shutdown(ctx context.Context) error
 }
+
+// Drainer is implemented by servers which can fail health checks
+// and deregister from discovery while still serving
+type Drainer interface {
+	/*
+	 * Drain start failing health checks before shutdown
+	 */
+	Drain(ctx context.Context) error
+}
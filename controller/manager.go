@@ -0,0 +1,332 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Manager runs a group of servers, and shutdowns or restarts them by commands
+type Manager struct {
+	// CommandCh is the "command channel" of the manager
+	CommandCh chan CtrlCommand
+
+	servers    []serverInfo
+	signals    Signals
+	hooks      []Hook
+	drainDelay time.Duration
+	started    bool
+	done       chan struct{}
+	lock       sync.Mutex
+}
+
+// NewManager creates a manager
+func NewManager() *Manager {
+	return &Manager{
+		CommandCh: make(chan CtrlCommand),
+		signals:   DefaultSignals(),
+		done:      make(chan struct{}),
+	}
+}
+
+// AddServer adds a server's info to the servers
+func (m *Manager) AddServer(network, address string, server Server) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// must not add a server after servers started
+	if m.started {
+		return ErrStarted
+	}
+	for _, svr := range m.servers {
+		if svr.network == network && svr.address == address {
+			return ErrConflict
+		}
+	}
+	if len(m.servers) <= 0 {
+		register(m)
+	}
+	m.servers = append(m.servers, serverInfo{
+		network: network,
+		address: address,
+		server:  server,
+	})
+	return nil
+}
+
+// Run runs all servers added, and returns after they are shutdown,
+// the errors of pre-start hooks, or shutdown hooks are returned as HookErrors.
+// startWait is the max time waiting the new process ready on restart,
+// shutdownWait is the max time of draining and shutting down the servers, including the drain delay
+func (m *Manager) Run(startWait, shutdownWait time.Duration) (err error) {
+	m.lock.Lock()
+	if m.started {
+		m.lock.Unlock()
+		return ErrStarted
+	}
+	m.started = true
+	m.lock.Unlock()
+	defer close(m.done)
+	defer unregister(m)
+
+	if errs := m.runHooks(PreStart); len(errs) > 0 {
+		notifyReady(errs)
+		return errs
+	}
+	if err = m.listen(); err != nil {
+		m.closeListeners()
+		notifyReady(err)
+		return
+	}
+	var wg sync.WaitGroup
+
+	// run the signal handler goroutine, signals are relayed before serving
+	stop := make(chan struct{})
+	defer close(stop)
+	if sch := m.notifySignals(); sch != nil {
+		go m.handleSignals(sch, stop)
+	}
+
+	// run servers each in a goroutine
+	for idx := range m.servers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			info := &m.servers[i]
+			err := info.server.Serve(info.listener)
+			if err != nil {
+				log.Printf("server %d serve error: %v", i, err)
+			}
+		}(idx)
+	}
+	m.runHooks(PostStart)
+	// tell the parent to shutdown if restarted
+	markServing(m)
+
+	// process control commands in a separate goroutine
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			cmd := <-m.CommandCh
+			switch cmd.Command {
+			case CommandShutdown:
+				err = m.shutdown(shutdownWait)
+				// not to block if nobody receives
+				if cmd.ErrCh != nil {
+					select {
+					case cmd.ErrCh <- err:
+					default:
+					}
+				}
+				return
+			case CommandRestart:
+				err := m.startProcess(startWait)
+				if cmd.ErrCh != nil {
+					cmd.ErrCh <- err
+				}
+				if errors.Is(err, ErrRestarting) {
+					continue
+				}
+				if err != nil {
+					log.Printf("restart error: %v", err)
+					continue
+				}
+				// the child took over all managers
+				for _, sm := range servingManagers() {
+					go sm.shutdownAsync()
+				}
+			}
+		}
+	}()
+
+	// wait until all finished
+	wg.Wait()
+	return
+}
+
+// Shutdown the running servers, returns after they are shutdown
+func (m *Manager) Shutdown() error {
+	return m.send(CommandShutdown)
+}
+
+// Restart the servers of all managers by a new process, returns after the new process is ready,
+// the failure is a *RestartError, with ErrRestarting if another manager is restarting the process
+func (m *Manager) Restart() error {
+	return m.send(CommandRestart)
+}
+
+// send a command and wait the result
+func (m *Manager) send(command int) error {
+	m.lock.Lock()
+	started := m.started
+	m.lock.Unlock()
+	if !started {
+		return ErrNotRunning
+	}
+	cmd := CtrlCommand{Command: command, ErrCh: make(chan error, 1)}
+	select {
+	case m.CommandCh <- cmd:
+	case <-m.done:
+		return ErrNotRunning
+	}
+	select {
+	case err := <-cmd.ErrCh:
+		return err
+	case <-m.done:
+		// the error may be sent just before done
+		select {
+		case err := <-cmd.ErrCh:
+			return err
+		default:
+			return nil
+		}
+	}
+}
+
+// listen gets listeners from inherited files matched by network and address, or creates them,
+// the inherited files not matched by any manager are closed after all managers listened
+func (m *Manager) listen() (err error) {
+	for idx := range m.servers {
+		info := &m.servers[idx]
+		if f := takeInherited(info.network, info.address, idx); f != nil {
+			info.listener, err = net.FileListener(f)
+			_ = f.Close()
+			if err != nil {
+				return inheritedError(info.network, info.address, err)
+			}
+			continue
+		}
+		info.listener, err = net.Listen(info.network, info.address)
+		if err != nil {
+			return
+		}
+	}
+	markListened(m)
+	return
+}
+
+func (m *Manager) closeListeners() {
+	for idx := range m.servers {
+		if l := m.servers[idx].listener; l != nil {
+			_ = l.Close()
+		}
+	}
+}
+
+// shutdown runs the shutdown hooks, drains and shutdowns the servers,
+// draining, the drain delay and shutting down share the deadline of wait
+func (m *Manager) shutdown(wait time.Duration) error {
+	errs := m.runHooks(PreShutdown)
+
+	m.lock.Lock()
+	delay := m.drainDelay
+	m.lock.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	m.drainServers(ctx)
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+		}
+	}
+	m.shutdownServers(ctx)
+
+	errs = append(errs, m.runHooks(PostShutdown)...)
+	return errs.err()
+}
+
+// drainServers makes the servers implementing Drainer fail health checks
+func (m *Manager) drainServers(ctx context.Context) {
+	for idx := range m.servers {
+		d, ok := m.servers[idx].server.(Drainer)
+		if !ok {
+			continue
+		}
+		if err := d.Drain(ctx); err != nil {
+			log.Printf("server %d drain error %v", idx, err)
+		}
+	}
+}
+
+func (m *Manager) shutdownServers(ctx context.Context) {
+	nch := make(chan struct{}, len(m.servers))
+
+	// call servers's shutdown, each in a goroutine
+	for idx := range m.servers {
+		go func(i int) {
+			info := &m.servers[i]
+			err := info.server.Shutdown(ctx)
+			if err != nil {
+				log.Printf("server %d shutdown error %v", i, err)
+			}
+			nch <- struct{}{}
+		}(idx)
+	}
+	var cnt int
+
+	// wait until all finished or timeout
+	for cnt < len(m.servers) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-nch:
+			cnt++
+		}
+	}
+}
+
+// shutdownAsync sends the shutdown command unless finished
+func (m *Manager) shutdownAsync() {
+	select {
+	case m.CommandCh <- CtrlCommand{Command: CommandShutdown}:
+	case <-m.done:
+	}
+}
+
+// startProcess with the listeners of all serving managers, only one at a time in the process
+func (m *Manager) startProcess(wait time.Duration) (err error) {
+	if !beginRestart() {
+		return &RestartError{Err: ErrRestarting}
+	}
+	defer func() { endRestart(err) }()
+	// convert net.Listener to *os.File
+	var files []*os.File
+	var names [][2]string
+	// the child has its own copies
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	for _, sm := range servingManagers() {
+		for idx := range sm.servers {
+			info := &sm.servers[idx]
+			var f *os.File
+			switch listener := info.listener.(type) {
+			case *net.TCPListener:
+				f, err = listener.File()
+			case *net.UnixListener:
+				f, err = listener.File()
+			default:
+				err = ErrUnsupported
+			}
+			if err != nil {
+				return &RestartError{Err: err}
+			}
+			files = append(files, f)
+			names = append(names, [2]string{info.network, info.address})
+		}
+	}
+
+	// start the new process with extra files
+	err = startAndWait(files, names, wait)
+	return
+}
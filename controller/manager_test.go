@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testServer struct {
+	served   int32
+	shutdown chan struct{}
+}
+
+func newTestServer() *testServer {
+	return &testServer{shutdown: make(chan struct{})}
+}
+
+func (s *testServer) Serve(l net.Listener) error {
+	atomic.AddInt32(&s.served, 1)
+	<-s.shutdown
+	return l.Close()
+}
+
+func (s *testServer) Shutdown(ctx context.Context) error {
+	close(s.shutdown)
+	return nil
+}
+
+func TestManager(t *testing.T) {
+	require := require.New(t)
+	m1, m2 := NewManager(), NewManager()
+	s1, s2 := newTestServer(), newTestServer()
+	require.NoError(m1.AddServer("tcp", "127.0.0.1:0", s1))
+	require.Equal(ErrConflict, m1.AddServer("tcp", "127.0.0.1:0", s1))
+	require.NoError(m2.AddServer("tcp", "127.0.0.1:0", s2))
+	require.Equal(ErrNotRunning, m1.Shutdown())
+
+	errs := make(chan error, 2)
+	go func() { errs <- m1.Run(time.Second, time.Second) }()
+	go func() { errs <- m2.Run(time.Second, time.Second) }()
+	require.Eventually(func() bool {
+		return atomic.LoadInt32(&s1.served) == 1 && atomic.LoadInt32(&s2.served) == 1
+	}, time.Second, time.Millisecond)
+	require.Equal(ErrStarted, m1.AddServer("tcp", "127.0.0.1:0", newTestServer()))
+
+	// managers are independent
+	require.NoError(m1.Shutdown())
+	require.NoError(<-errs)
+	select {
+	case <-s2.shutdown:
+		t.Fatal("m2 shutdown")
+	default:
+	}
+	require.Equal(ErrNotRunning, m1.Shutdown())
+
+	require.NoError(m2.Shutdown())
+	require.NoError(<-errs)
+}
+
+func TestManager_Signals(t *testing.T) {
+	require := require.New(t)
+	m := NewManager()
+	s := newTestServer()
+	require.NoError(m.AddServer("tcp", "127.0.0.1:0", s))
+	usr1 := make(chan os.Signal, 1)
+	require.NoError(m.OnSignal(func(sig os.Signal) { usr1 <- sig }, syscall.SIGUSR1))
+
+	errs := make(chan error, 1)
+	go func() { errs <- m.Run(time.Second, time.Second) }()
+	require.Eventually(func() bool {
+		return atomic.LoadInt32(&s.served) == 1
+	}, time.Second, time.Millisecond)
+	require.Equal(ErrStarted, m.SetSignals(DefaultSignals()))
+
+	require.NoError(syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	select {
+	case sig := <-usr1:
+		require.Equal(syscall.SIGUSR1, sig)
+	case <-time.After(time.Second):
+		t.Fatal("callback not called")
+	}
+
+	require.NoError(syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	select {
+	case err := <-errs:
+		require.NoError(err)
+	case <-time.After(time.Second):
+		t.Fatal("not shutdown by SIGTERM")
+	}
+}
+
+type drainServer struct {
+	*testServer
+	events *[]string
+}
+
+func (s drainServer) Drain(ctx context.Context) error {
+	*s.events = append(*s.events, "drain")
+	return nil
+}
+
+func (s drainServer) Shutdown(ctx context.Context) error {
+	*s.events = append(*s.events, "shutdown")
+	return s.testServer.Shutdown(ctx)
+}
+
+func TestManager_Hooks(t *testing.T) {
+	require := require.New(t)
+	m := NewManager()
+	var events []string
+	s := drainServer{testServer: newTestServer(), events: &events}
+	require.NoError(m.AddServer("tcp", "127.0.0.1:0", s))
+	hook := func(name string, stage Stage, err error) {
+		m.AddHook(Hook{Name: name, Stage: stage, Fn: func(ctx context.Context) error {
+			events = append(events, name)
+			return err
+		}})
+	}
+	hook("start1", PreStart, nil)
+	hook("start2", PreStart, nil)
+	hook("started", PostStart, nil)
+	hook("deregister", PreShutdown, nil)
+	hook("flush", PostShutdown, errors.New("flush failed"))
+	m.AddHook(Hook{Name: "slow", Stage: PostShutdown, Timeout: 10 * time.Millisecond, Fn: func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(time.Second)
+		return nil
+	}})
+	m.SetDrainDelay(20 * time.Millisecond)
+
+	errs := make(chan error, 1)
+	go func() { errs <- m.Run(time.Second, time.Second) }()
+	require.Eventually(func() bool {
+		return atomic.LoadInt32(&s.served) == 1
+	}, time.Second, time.Millisecond)
+
+	ts := time.Now()
+	err := m.Shutdown()
+	require.True(time.Since(ts) >= 20*time.Millisecond)
+	require.True(time.Since(ts) < time.Second)
+	he, ok := err.(HookErrors)
+	require.True(ok, err)
+	require.Len(he, 2)
+	require.Equal("flush", he[0].Name)
+	require.Equal(PostShutdown, he[0].Stage)
+	require.Equal(context.DeadlineExceeded, he[1].Err)
+	require.Equal(err, <-errs)
+	require.Equal([]string{"start1", "start2", "started", "deregister", "drain", "shutdown", "flush"}, events)
+}
+
+func TestManager_PreStartError(t *testing.T) {
+	require := require.New(t)
+	m := NewManager()
+	s := newTestServer()
+	require.NoError(m.AddServer("tcp", "127.0.0.1:0", s))
+	m.AddHook(Hook{Name: "conf", Stage: PreStart, Fn: func(ctx context.Context) error {
+		return errors.New("no conf")
+	}})
+	err := m.Run(time.Second, time.Second)
+	require.EqualError(err, "pre-start hook conf: no conf")
+	require.Equal(int32(0), atomic.LoadInt32(&s.served))
+}
+
+type slowServer struct {
+	*testServer
+}
+
+func (s slowServer) Shutdown(ctx context.Context) error {
+	<-ctx.Done()
+	return s.testServer.Shutdown(ctx)
+}
+
+func TestManager_ShutdownDeadline(t *testing.T) {
+	require := require.New(t)
+	m := NewManager()
+	s := slowServer{testServer: newTestServer()}
+	require.NoError(m.AddServer("tcp", "127.0.0.1:0", s))
+	m.SetDrainDelay(time.Second)
+
+	errs := make(chan error, 1)
+	go func() { errs <- m.Run(time.Second, 100*time.Millisecond) }()
+	require.Eventually(func() bool {
+		return atomic.LoadInt32(&s.served) == 1
+	}, time.Second, time.Millisecond)
+
+	// the drain delay and the slow shutdown share the wait
+	ts := time.Now()
+	require.NoError(m.Shutdown())
+	require.NoError(<-errs)
+	require.True(time.Since(ts) < 500*time.Millisecond, time.Since(ts))
+}
+
+func TestManager_ShutdownErrCh(t *testing.T) {
+	require := require.New(t)
+	m := NewManager()
+	s := newTestServer()
+	require.NoError(m.AddServer("tcp", "127.0.0.1:0", s))
+	m.AddHook(Hook{Name: "flush", Stage: PostShutdown, Fn: func(ctx context.Context) error {
+		return errors.New("flush failed")
+	}})
+
+	errs := make(chan error, 1)
+	go func() { errs <- m.Run(time.Second, time.Second) }()
+	require.Eventually(func() bool {
+		return atomic.LoadInt32(&s.served) == 1
+	}, time.Second, time.Millisecond)
+
+	// nobody receives the error, Run still returns
+	m.CommandCh <- CtrlCommand{Command: CommandShutdown, ErrCh: make(chan error)}
+	select {
+	case err := <-errs:
+		require.EqualError(err, "post-shutdown hook flush: flush failed")
+	case <-time.After(time.Second):
+		t.Fatal("blocked by ErrCh")
+	}
+}
@@ -1,46 +1,121 @@
 package controller
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	// readyMsg written by the child when all servers are serving
+	readyMsg = "ready"
+	// errorPrefix of the message written by the child when it fails to start
+	errorPrefix = "error "
+)
+
 var (
-	envKey         string
-	envFdsKey      string
-	isGraceful     bool
-	inheritedFiles []*os.File
+	// ErrNotReady means the child is not ready within the start wait
+	ErrNotReady = errors.New("child not ready in time")
+	// ErrChildExited means the child exited before ready
+	ErrChildExited = errors.New("child exited before ready")
+	// ErrChildFailed means the child reported a failure of starting
+	ErrChildFailed = errors.New("child failed to start")
+)
+
+// RestartError of a graceful restart
+type RestartError struct {
+	// Pid of the child, 0 if not started
+	Pid int
+	Err error
+}
+
+// Error implements error
+func (e *RestartError) Error() string {
+	return fmt.Sprintf("restart process %d: %v", e.Pid, e.Err)
+}
+
+// Unwrap the cause
+func (e *RestartError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	envKey      string
+	envFdsKey   string
+	envReadyKey string
+	isGraceful  bool
+	readyFile   *os.File
+	readyOnce   sync.Once
 )
 
 func init() {
 	base := strings.ToUpper(filepath.Base(os.Args[0]))
 	envKey = base + "_GRACEFUL"
 	envFdsKey = base + "_GRACEFUL_FDS"
+	envReadyKey = base + "_GRACEFUL_READY"
 	if os.Getenv(envKey) == "true" {
 		isGraceful = true
 	}
-	if cntStr := os.Getenv(envFdsKey); cntStr != "" {
-		cnt, err := strconv.ParseInt(cntStr, 10, 64)
-		if err != nil {
-			log.Fatalf("invalid fds in env: %s", cntStr)
+	if fds := os.Getenv(envFdsKey); fds != "" {
+		if err := parseInherited(fds); err != nil {
+			log.Fatalf("invalid fds in env: %s", fds)
 		}
-		inheritedFiles = make([]*os.File, cnt)
-		for i := 0; i < int(cnt); i++ {
-			inheritedFiles[i] = os.NewFile(uintptr(3+i), "")
+	}
+	if fdStr := os.Getenv(envReadyKey); fdStr != "" {
+		fd, err := strconv.ParseInt(fdStr, 10, 64)
+		if err != nil {
+			log.Fatalf("invalid ready fd in env: %s", fdStr)
 		}
+		readyFile = os.NewFile(uintptr(fd), "ready")
 	}
 }
 
-func startAndWait(files []*os.File, wait time.Duration) error {
+// notifyReady tells the parent the result of starting, only the first call works
+func notifyReady(err error) {
+	readyOnce.Do(func() {
+		if readyFile == nil {
+			return
+		}
+		msg := readyMsg
+		if err != nil {
+			msg = errorPrefix + strings.ReplaceAll(err.Error(), "\n", " ")
+		}
+		if _, e := readyFile.WriteString(msg + "\n"); e != nil {
+			log.Printf("notify ready error: %v", e)
+		}
+		_ = readyFile.Close()
+	})
+}
+
+// startAndWait starts the child with the listener files named by network and address
+func startAndWait(files []*os.File, names [][2]string, wait time.Duration) error {
+	fds, err := encodeInherited(names)
+	if err != nil {
+		return &RestartError{Err: err}
+	}
+
+	// the child writes the result of starting to the pipe
+	r, w, err := os.Pipe()
+	if err != nil {
+		return &RestartError{Err: err}
+	}
+	defer r.Close()
+	extra := make([]*os.File, 0, len(files)+1)
+	extra = append(extra, files...)
+	extra = append(extra, w)
+
 	env := os.Environ()
 	cnt := len(files)
-	slc := make([]string, 0, len(env)+cnt)
+	slc := make([]string, 0, len(env)+3)
 	for _, v := range env {
 		if !strings.HasPrefix(v, envKey) && !strings.HasPrefix(v, envFdsKey) {
 			slc = append(slc, v)
@@ -48,28 +123,75 @@ func startAndWait(files []*os.File, wait time.Duration) error {
 	}
 	if cnt > 0 {
 		slc = append(slc, envKey+"=true")
-		slc = append(slc, envFdsKey+"="+strconv.FormatInt(int64(cnt), 10))
+		slc = append(slc, envFdsKey+"="+fds)
 	}
+	slc = append(slc, envReadyKey+"="+strconv.FormatInt(int64(3+cnt), 10))
 
 	cmd := exec.Command(os.Args[0], os.Args[1:]...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Env = slc
-	cmd.ExtraFiles = files
+	cmd.ExtraFiles = extra
 
-	err := cmd.Start()
+	err = cmd.Start()
+	// only the child holds the write end, EOF if it exits
+	_ = w.Close()
 	if err != nil {
-		return err
+		return &RestartError{Err: err}
 	}
 
 	ch := make(chan error, 1)
 	go func() {
 		ch <- cmd.Wait()
 	}()
+	err = waitReady(r, ch, wait)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, ErrNotReady) {
+		// not to run two groups of servers
+		_ = cmd.Process.Kill()
+	}
+	return &RestartError{Pid: cmd.Process.Pid, Err: err}
+}
+
+// waitReady reads the result of starting from r, exited receives the exit of the child
+func waitReady(r io.Reader, exited <-chan error, wait time.Duration) error {
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(r).ReadString('\n')
+		lines <- strings.TrimSpace(line)
+	}()
+
 	select {
-	case <-time.After(wait):
-	case <-ch:
-		err = fmt.Errorf("process %d exited within %v", cmd.ProcessState.Pid(), wait)
+	case line := <-lines:
+		switch {
+		case line == readyMsg:
+			return nil
+		case strings.HasPrefix(line, errorPrefix):
+			return fmt.Errorf("%w: %s", ErrChildFailed, strings.TrimPrefix(line, errorPrefix))
+		case line != "":
+			return fmt.Errorf("%w: unexpected message %q", ErrChildFailed, line)
+		}
+		// closed without a message, the child is exiting
+		select {
+		case err := <-exited:
+			return exitError(err)
+		case <-t.C:
+			return ErrNotReady
+		}
+	case err := <-exited:
+		return exitError(err)
+	case <-t.C:
+		return ErrNotReady
+	}
+}
+
+func exitError(err error) error {
+	if err == nil {
+		return ErrChildExited
 	}
-	return err
+	return fmt.Errorf("%w: %v", ErrChildExited, err)
 }
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// envChildKey of the file the restarted test binary appends to, instead of running the tests
+const envChildKey = "CONTROLLER_TEST_CHILD"
+
+func TestMain(m *testing.M) {
+	if name := os.Getenv(envChildKey); name != "" {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			notifyReady(err)
+			os.Exit(1)
+		}
+		_, err = f.WriteString("child\n")
+		_ = f.Close()
+		notifyReady(err)
+		// a child exiting at once is not ready
+		time.Sleep(100 * time.Millisecond)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestWaitReady(t *testing.T) {
+	assert := assert.New(t)
+	wait := 100 * time.Millisecond
+	exited := func(err error) <-chan error {
+		ch := make(chan error, 1)
+		ch <- err
+		return ch
+	}
+	never := make(chan error)
+
+	assert.NoError(waitReady(strings.NewReader("ready\n"), never, wait))
+
+	err := waitReady(strings.NewReader("error address in use\n"), never, wait)
+	assert.True(errors.Is(err, ErrChildFailed))
+	assert.Contains(err.Error(), "address in use")
+
+	err = waitReady(strings.NewReader(""), exited(errors.New("exit status 1")), wait)
+	assert.True(errors.Is(err, ErrChildExited))
+	assert.Contains(err.Error(), "exit status 1")
+
+	r, w := io.Pipe()
+	defer w.Close()
+	assert.Equal(ErrNotReady, waitReady(r, never, wait))
+}
+
+func TestReady_Managers(t *testing.T) {
+	require := require.New(t)
+	r, w, err := os.Pipe()
+	require.NoError(err)
+	defer r.Close()
+	readyFile, readyOnce = w, sync.Once{}
+	defer func() { readyFile, readyOnce = nil, sync.Once{} }()
+
+	m1, m2 := NewManager(), NewManager()
+	require.NoError(m1.AddServer("tcp", ":8080", newTestServer()))
+	require.NoError(m2.AddServer("tcp", ":9090", newTestServer()))
+	defer unregister(m1)
+	defer unregister(m2)
+
+	// not ready until all managers are serving
+	markServing(m1)
+	require.Equal([]*Manager{m1}, servingManagers())
+	require.NoError(r.SetReadDeadline(time.Now().Add(50 * time.Millisecond)))
+	_, err = r.Read(make([]byte, 1))
+	require.True(os.IsTimeout(err))
+
+	markServing(m2)
+	require.Len(servingManagers(), 2)
+	require.NoError(r.SetReadDeadline(time.Time{}))
+	require.NoError(waitReady(r, make(chan error), time.Second))
+}
+
+func TestRestart_Managers(t *testing.T) {
+	require := require.New(t)
+	name := t.TempDir() + "/children"
+	require.NoError(os.Setenv(envChildKey, name))
+	defer os.Unsetenv(envChildKey)
+	defer func() { restarting = false }()
+
+	m1, m2 := NewManager(), NewManager()
+	s1, s2 := newTestServer(), newTestServer()
+	require.NoError(m1.AddServer("tcp", "127.0.0.1:0", s1))
+	require.NoError(m2.AddServer("tcp", "127.0.0.1:0", s2))
+	errs := make(chan error, 2)
+	go func() { errs <- m1.Run(5*time.Second, time.Second) }()
+	go func() { errs <- m2.Run(5*time.Second, time.Second) }()
+	require.Eventually(func() bool {
+		return len(servingManagers()) == 2
+	}, time.Second, time.Millisecond)
+
+	// both managers relay SIGHUP, one child takes over both
+	require.NoError(syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			require.NoError(err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("not shutdown after restart")
+		}
+	}
+	data, err := ioutil.ReadFile(name)
+	require.NoError(err)
+	require.Equal("child\n", string(data))
+	require.Equal(&RestartError{Err: ErrRestarting}, m1.startProcess(time.Second))
+}
@@ -0,0 +1,112 @@
+package controller
+
+import "sync"
+
+// managerState in the registry
+type managerState struct {
+	listened bool
+	serving  bool
+}
+
+// registry of the managers with servers in the process, a graceful restart hands over
+// the listeners of all of them, and the child is ready after all of them are serving,
+// so servers of all managers should be added before any of them runs
+var (
+	managers    = map[*Manager]*managerState{}
+	managersMtx sync.Mutex
+	// restarting since a restart began, kept after the child is ready as the process is handed over
+	restarting bool
+)
+
+// register the manager, called when its first server is added
+func register(m *Manager) {
+	managersMtx.Lock()
+	managers[m] = &managerState{}
+	managersMtx.Unlock()
+}
+
+// unregister the manager after it finished running
+func unregister(m *Manager) {
+	managersMtx.Lock()
+	defer managersMtx.Unlock()
+	if _, ok := managers[m]; !ok {
+		return
+	}
+	delete(managers, m)
+	checkListened()
+}
+
+// markListened after the manager got its listeners
+func markListened(m *Manager) {
+	managersMtx.Lock()
+	defer managersMtx.Unlock()
+	if st, ok := managers[m]; ok {
+		st.listened = true
+	}
+	checkListened()
+}
+
+// checkListened closes the inherited listeners not taken after all managers listened,
+// managersMtx must be held
+func checkListened() {
+	if !isGraceful {
+		return
+	}
+	for _, st := range managers {
+		if !st.listened {
+			return
+		}
+	}
+	closeInherited()
+}
+
+// markServing after the servers of the manager are serving,
+// the parent is told ready after all managers are serving
+func markServing(m *Manager) {
+	managersMtx.Lock()
+	defer managersMtx.Unlock()
+	if st, ok := managers[m]; ok {
+		st.serving = true
+	}
+	for _, st := range managers {
+		if !st.serving {
+			return
+		}
+	}
+	notifyReady(nil)
+}
+
+// servingManagers in the process, their listeners are ready
+func servingManagers() []*Manager {
+	managersMtx.Lock()
+	defer managersMtx.Unlock()
+	ms := make([]*Manager, 0, len(managers))
+	for m, st := range managers {
+		if st.serving {
+			ms = append(ms, m)
+		}
+	}
+	return ms
+}
+
+// beginRestart returns false if a restart of the process is in progress or done,
+// every manager relays the restart signals, but only one child should be started
+func beginRestart() bool {
+	managersMtx.Lock()
+	defer managersMtx.Unlock()
+	if restarting {
+		return false
+	}
+	restarting = true
+	return true
+}
+
+// endRestart allows restarting again after a failure
+func endRestart(err error) {
+	if err == nil {
+		return
+	}
+	managersMtx.Lock()
+	restarting = false
+	managersMtx.Unlock()
+}
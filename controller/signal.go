@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Signals configures the signals handled by a manager
+type Signals struct {
+	// Shutdown signals make the servers shutdown
+	Shutdown []os.Signal
+	// Restart signals make a graceful restart
+	Restart []os.Signal
+	// Callbacks called by the signal, like reopening logs on SIGUSR1
+	Callbacks map[os.Signal]func(os.Signal)
+}
+
+// DefaultSignals returns the signals handled by default
+func DefaultSignals() Signals {
+	return Signals{
+		Shutdown: []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT},
+		Restart:  []os.Signal{syscall.SIGHUP},
+	}
+}
+
+// SetSignals of the default manager
+func SetSignals(s Signals) error {
+	return defaultManager.SetSignals(s)
+}
+
+// OnSignal adds a callback to the default manager
+func OnSignal(fn func(os.Signal), sigs ...os.Signal) error {
+	return defaultManager.OnSignal(fn, sigs...)
+}
+
+// SetSignals replaces the signals handled, must be called before running
+func (m *Manager) SetSignals(s Signals) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.started {
+		return ErrStarted
+	}
+	callbacks := make(map[os.Signal]func(os.Signal), len(s.Callbacks))
+	for sig, fn := range s.Callbacks {
+		callbacks[sig] = fn
+	}
+	s.Callbacks = callbacks
+	m.signals = s
+	return nil
+}
+
+// OnSignal adds a callback of the signals, must be called before running
+func (m *Manager) OnSignal(fn func(os.Signal), sigs ...os.Signal) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.started {
+		return ErrStarted
+	}
+	if m.signals.Callbacks == nil {
+		m.signals.Callbacks = map[os.Signal]func(os.Signal){}
+	}
+	for _, sig := range sigs {
+		m.signals.Callbacks[sig] = fn
+	}
+	return nil
+}
+
+// notifySignals starts relaying the signals handled, nil if none
+func (m *Manager) notifySignals() chan os.Signal {
+	n := len(m.signals.Shutdown) + len(m.signals.Restart) + len(m.signals.Callbacks)
+	if n <= 0 {
+		return nil
+	}
+	sigs := make([]os.Signal, 0, n)
+	sigs = append(sigs, m.signals.Shutdown...)
+	sigs = append(sigs, m.signals.Restart...)
+	for sig := range m.signals.Callbacks {
+		sigs = append(sigs, sig)
+	}
+	sch := make(chan os.Signal, n)
+	signal.Notify(sch, sigs...)
+	return sch
+}
+
+// handleSignals converts signals to commands or calls the callbacks until stop closed
+func (m *Manager) handleSignals(sch chan os.Signal, stop <-chan struct{}) {
+	defer signal.Stop(sch)
+	commands := map[os.Signal]int{}
+	for _, sig := range m.signals.Shutdown {
+		commands[sig] = CommandShutdown
+	}
+	for _, sig := range m.signals.Restart {
+		commands[sig] = CommandRestart
+	}
+	for {
+		var sig os.Signal
+		select {
+		case sig = <-sch:
+		case <-stop:
+			return
+		}
+		if fn, ok := m.signals.Callbacks[sig]; ok {
+			fn(sig)
+		}
+		command, ok := commands[sig]
+		if !ok {
+			continue
+		}
+		select {
+		case m.CommandCh <- CtrlCommand{Command: command}:
+		case <-stop:
+			return
+		}
+	}
+}
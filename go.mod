@@ -7,13 +7,16 @@ require (
 	github.com/go-redis/redis/v8 v8.11.1
 	github.com/gomodule/redigo v1.8.5
 	github.com/hashicorp/consul/api v1.1.0
+	github.com/klauspost/compress v1.9.5
 	github.com/natefinch/lumberjack v2.0.0+incompatible
 	github.com/satori/go.uuid v1.2.0
 	github.com/spf13/jwalterweatherman v1.1.0
 	github.com/spf13/viper v1.8.1
 	github.com/stretchr/testify v1.7.0
+	github.com/ugorji/go/codec v1.1.7
 	go.mongodb.org/mongo-driver v1.7.0
 	go.uber.org/zap v1.18.1
 	google.golang.org/grpc v1.38.0
+	google.golang.org/protobuf v1.26.0
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
 )
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,12 +16,16 @@ import (
 
 // Server for gin service
 type Server struct {
-	rd time.Duration
-	sc []*consul.ServiceConf
-	hs *http.Server
+	rd      time.Duration
+	sc      []*consul.ServiceConf
+	hs      *http.Server
+	drained int32
 }
 
-var _ controller.Server = (*Server)(nil)
+var (
+	_ controller.Server  = (*Server)(nil)
+	_ controller.Drainer = (*Server)(nil)
+)
 
 // NewServer creates a gin server
 func NewServer(ops ...Option) *Server {
@@ -35,9 +40,6 @@ func NewServer(ops ...Option) *Server {
 	for _, m := range o.middleware {
 		engine.Use(m)
 	}
-	engine.Any("/health", func(ctx *gin.Context) {
-		ctx.String(http.StatusOK, "SUCCESS")
-	})
 	s := &Server{
 		rd: o.registerDelay,
 		sc: o.serviceConfig,
@@ -45,6 +47,13 @@ func NewServer(ops ...Option) *Server {
 			Handler: engine,
 		},
 	}
+	engine.Any("/health", func(ctx *gin.Context) {
+		if atomic.LoadInt32(&s.drained) != 0 {
+			ctx.String(http.StatusServiceUnavailable, "DRAINING")
+			return
+		}
+		ctx.String(http.StatusOK, "SUCCESS")
+	})
 	return s
 }
 
@@ -79,9 +88,17 @@ func (s *Server) Serve(l net.Listener) (err error) {
 	return nil
 }
 
+// Drain deregisters the server and fails the health checks, still serving
+func (s *Server) Drain(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&s.drained, 0, 1) {
+		return nil
+	}
+	return s.deregister()
+}
+
 // Shutdown the server
 func (s *Server) Shutdown(ctx context.Context) error {
-	if e := s.deregister(); e != nil {
+	if e := s.Drain(ctx); e != nil {
 		log.Printf("deregister service error: %v", e)
 	}
 	return s.hs.Shutdown(ctx)
@@ -1 +1,266 @@
 package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/skyandong/util/consul"
+	"github.com/skyandong/util/service"
+	"github.com/skyandong/util/trace"
+)
+
+// LocalIP 本机IP
+var LocalIP string
+
+func init() {
+	var err error
+	LocalIP, err = consul.LocalIP()
+	if err != nil {
+		log.Printf("Oops, LocalIP err: %v", err)
+	}
+}
+
+type addr struct {
+	RemoteIP string
+	LocalIP  string
+}
+
+func (a *addr) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("rmt", a.RemoteIP)
+	enc.AddString("loc", a.LocalIP)
+	return nil
+}
+
+// serverStream with the boss context
+type serverStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	recv int
+	sent int
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.recv++
+	}
+	return err
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent++
+	}
+	return err
+}
+
+// boss keeps the state of one call
+type boss struct {
+	options *options
+	logger  *zap.SugaredLogger
+	start   time.Time
+	method  string
+	md      metadata.MD
+	traceID string
+	addr    *addr
+	span    *trace.Span
+}
+
+// UnaryServerInterceptor Boss中间件
+func UnaryServerInterceptor(logger *zap.SugaredLogger, ops ...Option) grpc.UnaryServerInterceptor {
+	options, skips := newOptions(ops)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		b := newBoss(ctx, logger, options, info.FullMethod)
+		ctx = b.context(ctx)
+		if _, skip := skips[info.FullMethod]; skip {
+			return handler(ctx, req)
+		}
+
+		reply, err := handler(ctx, req)
+
+		m := b.fields(err)
+		m = append(m,
+			"body", processMessage(req),
+			"response", processMessage(reply),
+		)
+		b.log(m, err)
+		return reply, err
+	}
+}
+
+// StreamServerInterceptor Boss中间件
+func StreamServerInterceptor(logger *zap.SugaredLogger, ops ...Option) grpc.StreamServerInterceptor {
+	options, skips := newOptions(ops)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		b := newBoss(ss.Context(), logger, options, info.FullMethod)
+		ws := &serverStream{
+			ServerStream: ss,
+			ctx:          b.context(ss.Context()),
+		}
+		if _, skip := skips[info.FullMethod]; skip {
+			return handler(srv, ws)
+		}
+
+		err := handler(srv, ws)
+
+		m := b.fields(err)
+		m = append(m,
+			"recv", ws.recv,
+			"sent", ws.sent,
+		)
+		b.log(m, err)
+		return err
+	}
+}
+
+func newOptions(ops []Option) (*options, map[string]struct{}) {
+	options := &options{
+		latencyLimit: 300 * time.Millisecond,
+		serviceName:  LocalIP,
+	}
+	for _, opt := range ops {
+		opt(options)
+	}
+	skips := map[string]struct{}{
+		"/grpc.health.v1.Health/Check": {},
+		"/grpc.health.v1.Health/Watch": {},
+	}
+	for _, path := range options.pathFilter {
+		skips[path] = struct{}{}
+	}
+	return options, skips
+}
+
+func newBoss(ctx context.Context, logger *zap.SugaredLogger, options *options, method string) *boss {
+	start := time.Now()
+	md, _ := metadata.FromIncomingContext(ctx)
+	traceID := ""
+	if vs := md.Get(service.HeaderTraceID); len(vs) > 0 {
+		traceID = vs[0]
+	}
+	if traceID == "" {
+		traceID = uuid.NewV4().String()
+	}
+	clientIP := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		clientIP = p.Addr.String()
+		if i := strings.LastIndexByte(clientIP, ':'); i != -1 {
+			clientIP = clientIP[:i]
+		}
+	}
+
+	// full chain trace
+	ap := &trace.AddressPair{
+		RemoteIP: clientIP,
+		LocalIP:  LocalIP,
+	}
+	ti := trace.InfoFromMD(md, options.serviceName, start.UnixNano())
+	return &boss{
+		options: options,
+		logger:  logger,
+		start:   start,
+		method:  method,
+		md:      md,
+		traceID: traceID,
+		addr: &addr{
+			RemoteIP: clientIP,
+			LocalIP:  LocalIP,
+		},
+		span: trace.NewSpan(ti, ap, method, logger),
+	}
+}
+
+func (b *boss) context(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, service.TraceID, b.traceID)
+	return trace.SpanToContext(ctx, b.span)
+}
+
+func (b *boss) fields(err error) []interface{} {
+	elapse := time.Now().Sub(b.start).Nanoseconds() / int64(time.Millisecond)
+	m := []interface{}{
+		"addr", b.addr,
+		"elapse", elapse,
+		"url", b.method,
+		"status", status.Code(err).String(),
+		"method", "GRPC",
+		"traceID", b.traceID,
+		"traceInfo", b.span.TraceInfo,
+	}
+	if h := pickMetadata(b.md, b.options.headerPicker); len(h) > 0 {
+		m = append(m, "headers", h)
+	}
+	if err != nil {
+		m = append(m, "error", err.Error())
+	}
+	return m
+}
+
+func (b *boss) log(m []interface{}, err error) {
+	elapse := time.Now().Sub(b.start)
+	if b.options.logFilter != nil {
+		b.options.logFilter(m)
+	}
+	b.logger.Infow("jaeger-trace", m...)
+	if status.Code(err) != codes.OK || elapse >= b.options.latencyLimit {
+		b.logger.Errorw("error-trace", m...)
+	}
+}
+
+func pickMetadata(md metadata.MD, picker func(string) bool) json.RawMessage {
+	if len(md) <= 0 || picker == nil {
+		return nil
+	}
+	s := make([]string, 0, len(md))
+	for k, vs := range md {
+		if !picker(k) {
+			continue
+		}
+		for _, v := range vs {
+			s = append(s, k+": "+v)
+		}
+	}
+	if len(s) <= 0 {
+		return nil
+	}
+	d, _ := json.Marshal(s)
+	return d
+}
+
+func processMessage(msg interface{}) interface{} {
+	if msg == nil {
+		return nil
+	}
+	var (
+		data []byte
+		err  error
+	)
+	if pm, ok := msg.(proto.Message); ok {
+		data, err = protojson.Marshal(pm)
+	} else {
+		data, err = json.Marshal(msg)
+	}
+	// be compatible with json.RawMessage
+	if err != nil || len(data) <= 0 {
+		return nil
+	}
+	return json.RawMessage(data)
+}
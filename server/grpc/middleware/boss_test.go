@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/skyandong/util/service"
+	"github.com/skyandong/util/trace"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	require := require.New(t)
+	core, logs := observer.New(zapcore.InfoLevel)
+	i := UnaryServerInterceptor(zap.New(core).Sugar(), PathFilter([]string{"/test.Echo/Skip"}))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(service.HeaderTraceID, "tid"))
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		// the trace id and span of the call
+		require.Equal("tid", service.GetTraceID(ctx))
+		require.NotNil(trace.SpanFromContext(ctx))
+		if req == nil {
+			return nil, status.Error(codes.NotFound, "not found")
+		}
+		return req, nil
+	}
+
+	reply, err := i(ctx, map[string]string{"name": "a"}, &grpc.UnaryServerInfo{FullMethod: "/test.Echo/Echo"}, handler)
+	require.NoError(err)
+	require.Equal(map[string]string{"name": "a"}, reply)
+	require.Equal(1, logs.FilterMessage("jaeger-trace").Len())
+	fields := logs.All()[0].ContextMap()
+	require.Equal("/test.Echo/Echo", fields["url"])
+	require.Equal("OK", fields["status"])
+	require.Equal("tid", fields["traceID"])
+	require.Equal(0, logs.FilterMessage("error-trace").Len())
+
+	// errors are logged as well
+	_, err = i(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/test.Echo/Echo"}, handler)
+	require.Equal(codes.NotFound, status.Code(err))
+	require.Equal(1, logs.FilterMessage("error-trace").Len())
+
+	// health checks and filtered paths are not logged
+	logs.TakeAll()
+	for _, method := range []string{"/grpc.health.v1.Health/Check", "/test.Echo/Skip"} {
+		_, err = i(ctx, struct{}{}, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		require.NoError(err)
+	}
+	require.Equal(0, logs.Len())
+}
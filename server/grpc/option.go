@@ -1 +1,62 @@
 package grpc
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/skyandong/util/consul"
+)
+
+type options struct {
+	serviceConfig      []*consul.ServiceConf
+	registerDelay      time.Duration
+	unaryInterceptors  []grpc.UnaryServerInterceptor
+	streamInterceptors []grpc.StreamServerInterceptor
+	serverOptions      []grpc.ServerOption
+}
+
+// Option for server
+type Option func(*options)
+
+// ServiceConf for consul
+func ServiceConf(sc *consul.ServiceConf) Option {
+	return func(o *options) {
+		o.serviceConfig = []*consul.ServiceConf{sc}
+	}
+}
+
+// ServiceConfigs for consul
+func ServiceConfigs(cs []*consul.ServiceConf) Option {
+	return func(o *options) {
+		o.serviceConfig = cs
+	}
+}
+
+// RegisterDelay duration
+func RegisterDelay(rd time.Duration) Option {
+	return func(o *options) {
+		o.registerDelay = rd
+	}
+}
+
+// UnaryInterceptor for grpc, chained in order
+func UnaryInterceptor(is ...grpc.UnaryServerInterceptor) Option {
+	return func(o *options) {
+		o.unaryInterceptors = is
+	}
+}
+
+// StreamInterceptor for grpc, chained in order
+func StreamInterceptor(is ...grpc.StreamServerInterceptor) Option {
+	return func(o *options) {
+		o.streamInterceptors = is
+	}
+}
+
+// ServerOptions passed to grpc.NewServer as is
+func ServerOptions(so ...grpc.ServerOption) Option {
+	return func(o *options) {
+		o.serverOptions = so
+	}
+}
@@ -1 +1,149 @@
 package grpc
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/skyandong/util/consul"
+	"github.com/skyandong/util/controller"
+)
+
+// Server for grpc service
+type Server struct {
+	rd      time.Duration
+	sc      []*consul.ServiceConf
+	gs      *grpc.Server
+	hs      *health.Server
+	drained int32
+}
+
+var (
+	_ controller.Server  = (*Server)(nil)
+	_ controller.Drainer = (*Server)(nil)
+)
+
+// NewServer creates a grpc server
+func NewServer(ops ...Option) *Server {
+	o := options{
+		registerDelay: 2 * time.Second,
+	}
+	for _, op := range ops {
+		op(&o)
+	}
+	so := make([]grpc.ServerOption, 0, len(o.serverOptions)+2)
+	so = append(so, o.serverOptions...)
+	if len(o.unaryInterceptors) > 0 {
+		so = append(so, grpc.ChainUnaryInterceptor(o.unaryInterceptors...))
+	}
+	if len(o.streamInterceptors) > 0 {
+		so = append(so, grpc.ChainStreamInterceptor(o.streamInterceptors...))
+	}
+	gs := grpc.NewServer(so...)
+	hs := health.NewServer()
+	// consul checks the service by its name
+	for _, c := range o.serviceConfig {
+		hs.SetServingStatus(c.Name, grpc_health_v1.HealthCheckResponse_SERVING)
+	}
+	grpc_health_v1.RegisterHealthServer(gs, hs)
+	s := &Server{
+		rd: o.registerDelay,
+		sc: o.serviceConfig,
+		gs: gs,
+		hs: hs,
+	}
+	return s
+}
+
+// Serve on the listener
+func (s *Server) Serve(l net.Listener) (err error) {
+	var over bool
+	defer func() {
+		over = true
+		// normal close, already deregister
+		if err == nil {
+			return
+		}
+		// deregister after serve error
+		if e := s.deregister(); e != nil {
+			log.Printf("deregister service error: %v", e)
+		}
+	}()
+	go func() {
+		time.Sleep(s.rd)
+		if over {
+			return
+		}
+		// delay register, in case serve fails
+		if e := s.register(); e != nil {
+			log.Printf("register service error: %v", e)
+		}
+	}()
+	err = s.gs.Serve(l)
+	if err != grpc.ErrServerStopped {
+		return err
+	}
+	return nil
+}
+
+// Shutdown the server, stop it forcibly if ctx is done before graceful stop
+func (s *Server) Shutdown(ctx context.Context) error {
+	if e := s.Drain(ctx); e != nil {
+		log.Printf("deregister service error: %v", e)
+	}
+	ch := make(chan struct{})
+	go func() {
+		s.gs.GracefulStop()
+		close(ch)
+	}()
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		s.gs.Stop()
+		return ctx.Err()
+	}
+}
+
+// Drain deregisters the server and sets all services not serving, still serving
+func (s *Server) Drain(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&s.drained, 0, 1) {
+		return nil
+	}
+	s.hs.Shutdown()
+	return s.deregister()
+}
+
+// Origin grpc server, to register services on
+func (s *Server) Origin() *grpc.Server {
+	return s.gs
+}
+
+// Health server, to set serving status of services
+func (s *Server) Health() *health.Server {
+	return s.hs
+}
+
+func (s *Server) register() error {
+	for _, c := range s.sc {
+		if err := c.RegisterGRPC(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) deregister() error {
+	for _, c := range s.sc {
+		if err := c.Deregister(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
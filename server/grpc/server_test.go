@@ -0,0 +1,54 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestServer(t *testing.T) {
+	require := require.New(t)
+	var methods []string
+	s := NewServer(RegisterDelay(time.Hour), UnaryInterceptor(
+		func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			methods = append(methods, "first")
+			return handler(ctx, req)
+		},
+		func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			methods = append(methods, info.FullMethod)
+			return handler(ctx, req)
+		},
+	))
+	l := bufconn.Listen(1 << 20)
+	errs := make(chan error, 1)
+	go func() { errs <- s.Serve(l) }()
+
+	ctx := context.Background()
+	cc, err := grpc.DialContext(ctx, "bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return l.Dial()
+	}))
+	require.NoError(err)
+	defer cc.Close()
+	hc := grpc_health_v1.NewHealthClient(cc)
+
+	// interceptors are chained in order
+	rsp, err := hc.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(err)
+	require.Equal(grpc_health_v1.HealthCheckResponse_SERVING, rsp.Status)
+	require.Equal([]string{"first", "/grpc.health.v1.Health/Check"}, methods)
+
+	// not serving after drained, but still answers
+	require.NoError(s.Drain(ctx))
+	rsp, err = hc.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(err)
+	require.Equal(grpc_health_v1.HealthCheckResponse_NOT_SERVING, rsp.Status)
+
+	require.NoError(s.Shutdown(ctx))
+	require.NoError(<-errs)
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// BreakerState of a circuit breaker
+type BreakerState int
+
+// BreakerHookFunc is called on state transitions, name is the service or instance
+type BreakerHookFunc func(name string, from, to BreakerState)
+
+const (
+	// StateClosed lets requests through
+	StateClosed BreakerState = iota
+	// StateOpen rejects requests
+	StateOpen
+	// StateHalfOpen lets a few probe requests through
+	StateHalfOpen
+)
+
+const (
+	defaultBreakerWindow      = 10 * time.Second
+	defaultBreakerMinRequests = 20
+	defaultBreakerErrorRate   = 0.5
+	defaultBreakerOpenTimeout = 5 * time.Second
+)
+
+// ErrCircuitOpen means the request is rejected by the circuit breaker
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerResult of a call classified for breakers
+type BreakerResult int
+
+const (
+	// ResultSuccess is recorded as a success of the service
+	ResultSuccess BreakerResult = iota
+	// ResultFailure is recorded as a failure of the service
+	ResultFailure
+	// ResultIgnored is not recorded, like the cancellation by the caller
+	ResultIgnored
+)
+
+// ClassifyFunc classifies the result of a call for breakers
+type ClassifyFunc func(err error) BreakerResult
+
+// Classify is the default ClassifyFunc, the cancellation by the caller is ignored,
+// and any other error is a failure
+func Classify(err error) BreakerResult {
+	switch {
+	case err == nil:
+		return ResultSuccess
+	case errors.Is(err, context.Canceled):
+		return ResultIgnored
+	}
+	return ResultFailure
+}
+
+// Breaker with closed, open and half-open states
+type Breaker struct {
+	name       string
+	conf       BreakerConf
+	hook       BreakerHookFunc
+	lock       sync.Mutex
+	state      BreakerState
+	generation uint64
+	expiry     time.Time
+	total      int
+	failures   int
+	slows      int
+	probes     int
+	successes  int
+}
+
+var (
+	breakers    = map[string]*Breaker{}
+	breakersMtx sync.Mutex
+	// classifiers by the service type
+	classifiers = map[string]ClassifyFunc{}
+)
+
+// RegisterClassifier of the errors of the service type for breakers, should be called in init
+func RegisterClassifier(typ string, fn ClassifyFunc) {
+	classifiers[typ] = fn
+}
+
+// String of the state
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// NewBreaker with the conf, hook may be nil
+func NewBreaker(name string, conf BreakerConf, hook BreakerHookFunc) *Breaker {
+	if conf.Window <= 0 {
+		conf.Window = defaultBreakerWindow
+	}
+	if conf.MinRequests <= 0 {
+		conf.MinRequests = defaultBreakerMinRequests
+	}
+	if conf.ErrorRate <= 0 {
+		conf.ErrorRate = defaultBreakerErrorRate
+	}
+	if conf.OpenTimeout <= 0 {
+		conf.OpenTimeout = defaultBreakerOpenTimeout
+	}
+	if conf.HalfOpenRequests <= 0 {
+		conf.HalfOpenRequests = 1
+	}
+	return &Breaker{
+		name:   name,
+		conf:   conf,
+		hook:   hook,
+		expiry: time.Now().Add(conf.Window),
+	}
+}
+
+// GetBreaker returns the shared breaker of name, creates it if not exist
+func GetBreaker(name string, conf BreakerConf, hook BreakerHookFunc) *Breaker {
+	breakersMtx.Lock()
+	defer breakersMtx.Unlock()
+	b, ok := breakers[name]
+	if !ok {
+		b = NewBreaker(name, conf, hook)
+		breakers[name] = b
+	}
+	return b
+}
+
+// State of the breaker
+func (b *Breaker) State() BreakerState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refresh(time.Now())
+	return b.state
+}
+
+// Allow a request, done must be called with the result if no error,
+// the result is classified by Classify
+func (b *Breaker) Allow() (done func(err error, elapse time.Duration), err error) {
+	return b.allow(Classify)
+}
+
+func (b *Breaker) allow(classify ClassifyFunc) (done func(err error, elapse time.Duration), err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refresh(time.Now())
+	switch b.state {
+	case StateOpen:
+		return nil, ErrCircuitOpen
+	case StateHalfOpen:
+		if b.probes >= b.conf.HalfOpenRequests {
+			return nil, ErrCircuitOpen
+		}
+		b.probes++
+	}
+	generation := b.generation
+	done = func(err error, elapse time.Duration) {
+		b.done(generation, classify(err), elapse)
+	}
+	return done, nil
+}
+
+// Do fn if allowed, the result is recorded
+func (b *Breaker) Do(fn func() error) error {
+	return b.DoClassify(fn, nil)
+}
+
+// DoClassify fn if allowed, the result is classified by classify, Classify if nil
+func (b *Breaker) DoClassify(fn func() error, classify ClassifyFunc) error {
+	if classify == nil {
+		classify = Classify
+	}
+	done, err := b.allow(classify)
+	if err != nil {
+		return err
+	}
+	ts := time.Now()
+	err = fn()
+	done(err, time.Now().Sub(ts))
+	return err
+}
+
+func (b *Breaker) done(generation uint64, result BreakerResult, elapse time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	b.refresh(now)
+	// result of the previous state
+	if generation != b.generation {
+		return
+	}
+	if result == ResultIgnored {
+		// let another probe through
+		if b.state == StateHalfOpen {
+			b.probes--
+		}
+		return
+	}
+	failed := result == ResultFailure
+	slow := b.conf.SlowCall > 0 && elapse >= b.conf.SlowCall
+	switch b.state {
+	case StateClosed:
+		b.total++
+		if failed {
+			b.failures++
+		}
+		if slow {
+			b.slows++
+		}
+		if b.total < b.conf.MinRequests {
+			return
+		}
+		total := float64(b.total)
+		if float64(b.failures)/total >= b.conf.ErrorRate ||
+			(b.conf.SlowRate > 0 && float64(b.slows)/total >= b.conf.SlowRate) {
+			b.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		if failed || slow {
+			b.setState(StateOpen, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.conf.HalfOpenRequests {
+			b.setState(StateClosed, now)
+		}
+	}
+}
+
+// refresh the state by time
+func (b *Breaker) refresh(now time.Time) {
+	if now.Before(b.expiry) {
+		return
+	}
+	switch b.state {
+	case StateClosed:
+		b.reset(now.Add(b.conf.Window))
+	case StateOpen:
+		b.setState(StateHalfOpen, now)
+	}
+}
+
+func (b *Breaker) setState(state BreakerState, now time.Time) {
+	prev := b.state
+	b.state = state
+	switch state {
+	case StateClosed:
+		b.reset(now.Add(b.conf.Window))
+	case StateOpen:
+		b.reset(now.Add(b.conf.OpenTimeout))
+	case StateHalfOpen:
+		// no expiry until the probes finish
+		b.reset(time.Time{})
+	}
+	if b.hook != nil {
+		// called with lock held, must not call back to the breaker
+		b.hook(b.name, prev, state)
+	}
+}
+
+func (b *Breaker) reset(expiry time.Time) {
+	b.generation++
+	b.expiry = expiry
+	b.total = 0
+	b.failures = 0
+	b.slows = 0
+	b.probes = 0
+	b.successes = 0
+}
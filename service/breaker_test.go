@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	require := require.New(t)
+	var transitions []BreakerState
+	b := NewBreaker("test", BreakerConf{
+		MinRequests:      4,
+		ErrorRate:        0.5,
+		OpenTimeout:      50 * time.Millisecond,
+		HalfOpenRequests: 1,
+	}, func(name string, from, to BreakerState) {
+		transitions = append(transitions, to)
+	})
+	fail := errors.New("fail")
+
+	// open after error rate reached
+	for i := 0; i < 4; i++ {
+		_ = b.Do(func() error {
+			if i%2 == 0 {
+				return fail
+			}
+			return nil
+		})
+	}
+	require.Equal(StateOpen, b.State())
+	require.Equal(ErrCircuitOpen, b.Do(func() error { return nil }))
+
+	// half open after timeout, only one probe allowed
+	time.Sleep(60 * time.Millisecond)
+	done, err := b.Allow()
+	require.NoError(err)
+	_, err = b.Allow()
+	require.Equal(ErrCircuitOpen, err)
+
+	// failed probe opens again
+	done(fail, 0)
+	require.Equal(StateOpen, b.State())
+
+	// canceled probe is ignored, another one is allowed
+	time.Sleep(60 * time.Millisecond)
+	done, err = b.Allow()
+	require.NoError(err)
+	done(fmt.Errorf("get: %w", context.Canceled), 0)
+	require.Equal(StateHalfOpen, b.State())
+
+	// successful probe closes
+	require.NoError(b.Do(func() error { return nil }))
+	require.Equal(StateClosed, b.State())
+	require.Equal([]BreakerState{StateOpen, StateHalfOpen, StateOpen, StateHalfOpen, StateClosed}, transitions)
+}
+
+func TestClassify(t *testing.T) {
+	require := require.New(t)
+	require.Equal(ResultSuccess, Classify(nil))
+	require.Equal(ResultIgnored, Classify(context.Canceled))
+	require.Equal(ResultIgnored, Classify(fmt.Errorf("get: %w", context.Canceled)))
+	require.Equal(ResultFailure, Classify(context.DeadlineExceeded))
+	require.Equal(ResultFailure, Classify(errors.New("refused")))
+}
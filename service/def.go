@@ -25,6 +25,14 @@ const (
 	ExtraHeaders HeaderKeyType = "extra-headers"
 	// TraceID for key name
 	TraceID TraceKeyType = "traceID"
+	// Attempt for key name, the retry attempt starts from 1
+	Attempt TraceKeyType = "attempt"
+	// Hedged for key name, true for the hedged duplicate request
+	Hedged TraceKeyType = "hedged"
+	// CacheHit for key name, true if the reply is from the cache or a collapsed request
+	CacheHit TraceKeyType = "cacheHit"
+	// Sizes for key name, body sizes of the call
+	Sizes TraceKeyType = "sizes"
 	// HeaderTraceID for HTTP & GRPC
 	HeaderTraceID = "trace-id"
 )
@@ -36,12 +44,46 @@ var (
 	converters = map[string]CallFunc{}
 )
 
+// BodySize of a call, wire sizes are the compressed ones
+type BodySize struct {
+	RequestRaw   int64 `json:"reqRaw"`
+	RequestWire  int64 `json:"reqWire"`
+	ResponseRaw  int64 `json:"rspRaw"`
+	ResponseWire int64 `json:"rspWire"`
+}
+
 // Service 定义一个服务
 type Service struct {
 	// Type 服务发现类型 或 grpc
 	Type string `json:"type" yaml:"type"`
 	// Name 服务名
 	Name string `json:"name" yaml:"name"`
+	// Balance 实例选择策略, 用于进程内服务发现
+	Balance string `json:"balance" yaml:"balance"`
+	// Discovery 进程内服务发现配置, nil 使用默认配置
+	Discovery *DiscoveryConf `json:"discovery" yaml:"discovery"`
+	// StatusCodes 接受的HTTP状态码, 如 "200", "2xx", 默认只接受200
+	StatusCodes []string `json:"statusCodes" yaml:"statusCodes"`
+	// Transport HTTP连接配置, nil 使用默认配置
+	Transport *TransportConf `json:"transport" yaml:"transport"`
+	// Retry 重试策略, nil 不重试
+	Retry *RetryConf `json:"retry" yaml:"retry"`
+	// Compress 请求体压缩策略, nil 不压缩
+	Compress *CompressConf `json:"compress" yaml:"compress"`
+	// Cache GET响应缓存策略, nil 不缓存
+	Cache *CacheConf `json:"cache" yaml:"cache"`
+	// Limit 限流策略, nil 不限流
+	Limit *LimitConf `json:"limit" yaml:"limit"`
+	// Hedge 对冲请求策略, nil 不对冲
+	Hedge *HedgeConf `json:"hedge" yaml:"hedge"`
+	// Breaker 熔断策略, nil 不熔断
+	Breaker *BreakerConf `json:"breaker" yaml:"breaker"`
+	// BreakerHook 熔断状态变化回调
+	BreakerHook BreakerHookFunc `json:"-" yaml:"-"`
+	// BreakerClassify 熔断的失败判定, nil 使用服务类型注册的判定
+	BreakerClassify ClassifyFunc `json:"-" yaml:"-"`
+	// Interceptors 调用拦截器, 在全局拦截器之后执行
+	Interceptors []Interceptor `json:"-" yaml:"-"`
 	// Trace 调用者跟踪
 	Trace CallerTraceFunc `json:"-" yaml:"-"`
 }
@@ -52,7 +94,39 @@ func (s Service) Call(ctx context.Context, path string, req, reply interface{})
 	if !ok {
 		return fmt.Errorf("unknown service type: %s", s.Type)
 	}
-	return fn(ctx, s, path, req, reply)
+	return s.Invoke(ctx, path, req, reply, fn)
+}
+
+// Throttle fn with the limiter of the service if configured
+func (s Service) Throttle(ctx context.Context, fn func() error) error {
+	if s.Limit == nil {
+		return fn()
+	}
+	return GetLimiter(s.String(), *s.Limit).Do(ctx, fn)
+}
+
+// Protect fn with the circuit breaker of the service if configured
+func (s Service) Protect(fn func() error) error {
+	if s.Breaker == nil {
+		return fn()
+	}
+	return GetBreaker(s.String(), *s.Breaker, s.BreakerHook).DoClassify(fn, s.classifier())
+}
+
+// ProtectInstance fn with the circuit breaker of the instance if configured per instance
+func (s Service) ProtectInstance(addr string, fn func() error) error {
+	if s.Breaker == nil || !s.Breaker.PerInstance || addr == "" {
+		return fn()
+	}
+	return GetBreaker(s.String()+"@"+addr, *s.Breaker, s.BreakerHook).DoClassify(fn, s.classifier())
+}
+
+// classifier of the errors for breakers
+func (s Service) classifier() ClassifyFunc {
+	if s.BreakerClassify != nil {
+		return s.BreakerClassify
+	}
+	return classifiers[s.Type]
 }
 
 // DoTrace used by the middleware
@@ -89,6 +163,52 @@ func GetTraceID(c context.Context) string {
 	return ""
 }
 
+// WithAttempt adds the retry attempt to context
+func WithAttempt(c context.Context, attempt int) context.Context {
+	return context.WithValue(c, Attempt, attempt)
+}
+
+// GetAttempt from context, 0 if retry is not enabled
+func GetAttempt(c context.Context) int {
+	if n, ok := c.Value(Attempt).(int); ok {
+		return n
+	}
+	return 0
+}
+
+// WithHedged marks the context of a hedged duplicate request
+func WithHedged(c context.Context) context.Context {
+	return context.WithValue(c, Hedged, true)
+}
+
+// IsHedged returns whether the context is of a hedged duplicate request
+func IsHedged(c context.Context) bool {
+	h, _ := c.Value(Hedged).(bool)
+	return h
+}
+
+// WithCacheHit marks the context of a call replied without its own request
+func WithCacheHit(c context.Context) context.Context {
+	return context.WithValue(c, CacheHit, true)
+}
+
+// IsCacheHit returns whether the call is replied from the cache or a collapsed request
+func IsCacheHit(c context.Context) bool {
+	h, _ := c.Value(CacheHit).(bool)
+	return h
+}
+
+// WithBodySize adds the body sizes to context for the caller trace
+func WithBodySize(c context.Context, size *BodySize) context.Context {
+	return context.WithValue(c, Sizes, size)
+}
+
+// GetBodySize from context, nil if unknown
+func GetBodySize(c context.Context) *BodySize {
+	size, _ := c.Value(Sizes).(*BodySize)
+	return size
+}
+
 // GetExtraHeaders from context
 func GetExtraHeaders(c context.Context) map[string]string {
 	if m, ok := c.Value(ExtraHeaders).(map[string]string); ok {
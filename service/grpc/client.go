@@ -0,0 +1,77 @@
+package grpc
+
+import (
+	"sync"
+
+	"google.golang.org/grpc"
+
+	"github.com/skyandong/util/service"
+)
+
+// ConnCache for GRPC
+type ConnCache struct {
+	cache   map[string]*grpc.ClientConn
+	lock    sync.RWMutex
+	options []grpc.DialOption
+}
+
+// DefaultConnCache ...
+var DefaultConnCache *ConnCache
+
+func init() {
+	DefaultConnCache = NewConnCache(grpc.WithInsecure())
+}
+
+// Get a GRPC connection form global cache
+func Get(service Service) (*grpc.ClientConn, error) {
+	return DefaultConnCache.Get(service)
+}
+
+// NewConnCache create a new cache, options are used to dial every connection
+func NewConnCache(options ...grpc.DialOption) *ConnCache {
+	return &ConnCache{
+		cache:   make(map[string]*grpc.ClientConn),
+		options: options,
+	}
+}
+
+// Get a GRPC connection, dial it if not exist
+func (m *ConnCache) Get(s Service) (c *grpc.ClientConn, err error) {
+	// service key
+	key := service.Service(s).String()
+
+	// get from cache
+	m.lock.RLock()
+	c, ok := m.cache[key]
+	m.lock.RUnlock()
+
+	// not found
+	if !ok {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+
+		// try get again
+		c, ok = m.cache[key]
+		if !ok {
+			c, err = grpc.Dial(s.Name, m.options...)
+			if err != nil {
+				return nil, err
+			}
+			m.cache[key] = c
+		}
+	}
+	return c, nil
+}
+
+// Close all connections in the cache
+func (m *ConnCache) Close() (err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for key, c := range m.cache {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(m.cache, key)
+	}
+	return
+}
@@ -0,0 +1,33 @@
+package grpc
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// JSONCodecName as the content subtype
+const JSONCodecName = "json"
+
+// JSONCodec for messages which are not protobuf,
+// the server must register it as well
+type JSONCodec struct{}
+
+func init() {
+	encoding.RegisterCodec(JSONCodec{})
+}
+
+// Marshal v to json
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal json data to v
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Name of the codec
+func (JSONCodec) Name() string {
+	return JSONCodecName
+}
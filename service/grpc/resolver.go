@@ -0,0 +1,124 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/resolver"
+
+	"github.com/skyandong/util/consul"
+)
+
+// ConsulScheme for target like "consul://[agent-addr]/service-name[?tag=a&tag=b&dc=dc1&lb=round_robin]",
+// instances must have all tags, lb is the balancer and defaults to round_robin.
+// The slash after the agent is required, "consul:///service-name" for the local agent,
+// "consul://service-name" is dialed as a host name by grpc, see ConsulTarget
+const ConsulScheme = "consul"
+
+const defaultBalancer = "round_robin"
+
+type consulBuilder struct{}
+
+type consulResolver struct {
+	cc     resolver.ClientConn
+	wc     *consul.WatchConf
+	sc     string
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func init() {
+	resolver.Register(consulBuilder{})
+}
+
+// ConsulTarget of the service on the local agent, instances must have all tags
+func ConsulTarget(name string, tags ...string) string {
+	target := ConsulScheme + ":///" + name
+	if len(tags) > 0 {
+		target += "?" + url.Values{"tag": tags}.Encode()
+	}
+	return target
+}
+
+// Build a resolver watching the consul service of target
+func (consulBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	wc, lb, err := parseConsulTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &consulResolver{
+		cc:     cc,
+		wc:     wc,
+		sc:     fmt.Sprintf(`{"loadBalancingConfig":[{"%s":{}}]}`, lb),
+		cancel: cancel,
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		wc.Watch(ctx, r.update)
+	}()
+	return r, nil
+}
+
+// Scheme of consul
+func (consulBuilder) Scheme() string {
+	return ConsulScheme
+}
+
+// ResolveNow is not needed, changes are pushed by the blocking queries
+func (r *consulResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+// Close the resolver
+func (r *consulResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+func (r *consulResolver) update(ins []*consul.Instance, err error) {
+	if err != nil {
+		r.cc.ReportError(err)
+		return
+	}
+	addrs := make([]resolver.Address, 0, len(ins))
+	for _, i := range ins {
+		addrs = append(addrs, resolver.Address{
+			Addr:       i.HostPort(),
+			ServerName: r.wc.Name,
+		})
+	}
+	_ = r.cc.UpdateState(resolver.State{
+		Addresses:     addrs,
+		ServiceConfig: r.cc.ParseServiceConfig(r.sc),
+	})
+}
+
+func parseConsulTarget(target resolver.Target) (wc *consul.WatchConf, lb string, err error) {
+	name, query := target.Endpoint, ""
+	if i := strings.IndexByte(name, '?'); i != -1 {
+		name, query = name[:i], name[i+1:]
+	}
+	if name == "" {
+		return nil, "", fmt.Errorf("consul target without service name: %s", target.Endpoint)
+	}
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, "", err
+	}
+	wc = &consul.WatchConf{
+		Name:       name,
+		Tags:       q["tag"],
+		Datacenter: q.Get("dc"),
+	}
+	if target.Authority != "" {
+		wc.Agent = &consul.AgentConf{Address: target.Authority}
+	}
+	lb = q.Get("lb")
+	if lb == "" {
+		lb = defaultBalancer
+	}
+	return
+}
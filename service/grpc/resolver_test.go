@@ -0,0 +1,95 @@
+package grpc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+
+	"github.com/skyandong/util/consul"
+)
+
+func TestConsulTarget(t *testing.T) {
+	require := require.New(t)
+	require.Equal("consul:///echo", ConsulTarget("echo"))
+	require.Equal("consul:///echo?tag=a&tag=b", ConsulTarget("echo", "a", "b"))
+}
+
+func TestParseConsulTarget(t *testing.T) {
+	require := require.New(t)
+
+	// the local agent, round_robin by default
+	wc, lb, err := parseConsulTarget(resolver.Target{Scheme: ConsulScheme, Endpoint: "echo"})
+	require.NoError(err)
+	require.Equal(&consul.WatchConf{Name: "echo"}, wc)
+	require.Equal(defaultBalancer, lb)
+
+	wc, lb, err = parseConsulTarget(resolver.Target{
+		Scheme:    ConsulScheme,
+		Authority: "10.0.0.1:8500",
+		Endpoint:  "echo?tag=a&tag=b&dc=dc1&lb=pick_first",
+	})
+	require.NoError(err)
+	require.Equal(&consul.WatchConf{
+		Name:       "echo",
+		Tags:       []string{"a", "b"},
+		Datacenter: "dc1",
+		Agent:      &consul.AgentConf{Address: "10.0.0.1:8500"},
+	}, wc)
+	require.Equal("pick_first", lb)
+
+	_, _, err = parseConsulTarget(resolver.Target{Scheme: ConsulScheme, Endpoint: "?tag=a"})
+	require.Error(err)
+	_, _, err = parseConsulTarget(resolver.Target{Scheme: ConsulScheme, Endpoint: "echo?tag=%zz"})
+	require.Error(err)
+}
+
+type testClientConn struct {
+	resolver.ClientConn
+	state resolver.State
+	sc    string
+	err   error
+}
+
+func (cc *testClientConn) UpdateState(s resolver.State) error {
+	cc.state = s
+	return nil
+}
+
+func (cc *testClientConn) ReportError(err error) {
+	cc.err = err
+}
+
+func (cc *testClientConn) ParseServiceConfig(sc string) *serviceconfig.ParseResult {
+	cc.sc = sc
+	return &serviceconfig.ParseResult{}
+}
+
+func TestConsulResolver_Update(t *testing.T) {
+	require := require.New(t)
+	cc := &testClientConn{}
+	r := &consulResolver{
+		cc: cc,
+		wc: &consul.WatchConf{Name: "echo"},
+		sc: `{"loadBalancingConfig":[{"round_robin":{}}]}`,
+	}
+
+	r.update([]*consul.Instance{
+		{Address: "10.0.0.1", Port: 8080},
+		{Address: "10.0.0.2", Port: 8080},
+	}, nil)
+	require.Equal([]resolver.Address{
+		{Addr: "10.0.0.1:8080", ServerName: "echo"},
+		{Addr: "10.0.0.2:8080", ServerName: "echo"},
+	}, cc.state.Addresses)
+	require.NotNil(cc.state.ServiceConfig)
+	require.Equal(r.sc, cc.sc)
+
+	// errors are reported, the addresses are kept
+	fail := errors.New("agent down")
+	r.update(nil, fail)
+	require.Equal(fail, cc.err)
+	require.Len(cc.state.Addresses, 2)
+}
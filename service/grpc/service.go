@@ -0,0 +1,101 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/skyandong/util/service"
+	"github.com/skyandong/util/trace"
+)
+
+// GRPC 服务类型, Name 为 grpc.Dial 的 target, 如 host:port 或 ConsulTarget("name") 即 consul:///name
+const GRPC = "grpc"
+
+// Service 定义一个服务
+type Service service.Service
+
+func init() {
+	service.RegisterConverter(GRPC, callGRPC)
+	service.RegisterClassifier(GRPC, classify)
+}
+
+// classify the errors for breakers, client errors are not failures, and the cancellation is ignored
+func classify(err error) service.BreakerResult {
+	st, ok := status.FromError(err)
+	if !ok {
+		return service.Classify(err)
+	}
+	switch st.Code() {
+	case codes.OK:
+		return service.ResultSuccess
+	case codes.Canceled:
+		return service.ResultIgnored
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted,
+		codes.Internal, codes.Unknown, codes.DataLoss:
+		return service.ResultFailure
+	}
+	return service.ResultSuccess
+}
+
+func callGRPC(ctx context.Context, svc service.Service, path string, req, reply interface{}) (err error) {
+	// already intercepted by service.Call
+	return Service(svc).call(ctx, path, req, reply)
+}
+
+// Call 调用path对应的方法, 如 "/pkg.Service/Method", 并解析结果到reply
+func (s Service) Call(ctx context.Context, path string, req, reply interface{}) (err error) {
+	return service.Service(s).Invoke(ctx, path, req, reply, callGRPC)
+}
+
+func (s Service) call(ctx context.Context, path string, req, reply interface{}) (err error) {
+	ts := time.Now()
+	err = s.invoke(ctx, path, req, reply)
+	svc := service.Service(s)
+	svc.DoTrace(ctx, svc, path, req, reply, time.Now().Sub(ts), err)
+	return
+}
+
+func (s Service) invoke(ctx context.Context, path string, req, reply interface{}, opts ...grpc.CallOption) error {
+	if s.Type != GRPC {
+		return service.ErrServiceType
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	c, err := DefaultConnCache.Get(s)
+	if err != nil {
+		return err
+	}
+	ctx = outgoingContext(ctx)
+	_, reqProto := req.(proto.Message)
+	_, replyProto := reply.(proto.Message)
+	if !reqProto || !replyProto {
+		opts = append(opts, grpc.CallContentSubtype(JSONCodecName))
+	}
+	return c.Invoke(ctx, path, req, reply, opts...)
+}
+
+func outgoingContext(ctx context.Context) context.Context {
+	kvs := make([]string, 0, 8)
+	if tid := service.GetTraceID(ctx); tid != "" {
+		kvs = append(kvs, service.HeaderTraceID, tid)
+	}
+	for k, v := range service.GetExtraHeaders(ctx) {
+		kvs = append(kvs, strings.ToLower(k), v)
+	}
+	if len(kvs) > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, kvs...)
+	}
+	span := trace.SpanFromContext(ctx)
+	if span != nil {
+		ctx = trace.InfoToContext(ctx, span.TraceInfo)
+	}
+	return ctx
+}
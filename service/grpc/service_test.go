@@ -0,0 +1,80 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/skyandong/util/service"
+)
+
+// newTestServer on a bufconn listener, the default conn cache dials it
+func newTestServer(t *testing.T, opts ...grpc.ServerOption) *grpc.Server {
+	l := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer(opts...)
+	t.Cleanup(gs.Stop)
+	cache := DefaultConnCache
+	DefaultConnCache = NewConnCache(grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return l.Dial()
+	}))
+	t.Cleanup(func() {
+		_ = DefaultConnCache.Close()
+		DefaultConnCache = cache
+	})
+	go func() { _ = gs.Serve(l) }()
+	return gs
+}
+
+func TestService_Call(t *testing.T) {
+	require := require.New(t)
+	traceIDs := make(chan string, 1)
+	gs := newTestServer(t, grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		traceIDs <- strings.Join(md.Get(service.HeaderTraceID), ",")
+		return handler(ctx, req)
+	}), grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		var req map[string]string
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		return stream.SendMsg(map[string]string{"echo": req["name"]})
+	}))
+	grpc_health_v1.RegisterHealthServer(gs, health.NewServer())
+	s := Service{Type: GRPC, Name: "bufnet"}
+	ctx := context.WithValue(context.Background(), service.TraceID, "tid")
+
+	// protobuf messages
+	reply := &grpc_health_v1.HealthCheckResponse{}
+	require.NoError(s.Call(ctx, "grpc.health.v1.Health/Check", &grpc_health_v1.HealthCheckRequest{}, reply))
+	require.Equal(grpc_health_v1.HealthCheckResponse_SERVING, reply.Status)
+	require.Equal("tid", <-traceIDs)
+
+	// others by json
+	var echo map[string]string
+	require.NoError(s.Call(ctx, "/test.Echo/Echo", map[string]string{"name": "a"}, &echo))
+	require.Equal(map[string]string{"echo": "a"}, echo)
+
+	require.Equal(service.ErrServiceType, Service{Type: "http", Name: "bufnet"}.Call(ctx, "/test.Echo/Echo", nil, nil))
+}
+
+func TestClassify(t *testing.T) {
+	require := require.New(t)
+	require.Equal(service.ResultSuccess, classify(nil))
+	require.Equal(service.ResultIgnored, classify(status.Error(codes.Canceled, "canceled")))
+	require.Equal(service.ResultIgnored, classify(fmt.Errorf("call: %w", context.Canceled)))
+	require.Equal(service.ResultSuccess, classify(status.Error(codes.NotFound, "not found")))
+	require.Equal(service.ResultFailure, classify(status.Error(codes.Unavailable, "down")))
+	require.Equal(service.ResultFailure, classify(errors.New("refused")))
+}
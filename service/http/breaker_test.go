@@ -0,0 +1,91 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skyandong/util/service"
+)
+
+func TestService_Breaker(t *testing.T) {
+	require := require.New(t)
+	conf := &service.BreakerConf{MinRequests: 2, ErrorRate: 0.5, OpenTimeout: time.Minute}
+	ctx := context.Background()
+
+	// 4xx is the fault of the caller
+	var calls int32
+	s := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	})
+	s.Breaker = conf
+	for i := 0; i < 5; i++ {
+		_, err := s.GetJSON(ctx, "/")
+		require.IsType(&StatusError{}, err)
+	}
+	require.Equal(int32(5), atomic.LoadInt32(&calls))
+
+	// nor the decoding errors
+	s = newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("not json"))
+	})
+	s.Breaker = conf
+	for i := 0; i < 3; i++ {
+		var reply map[string]string
+		err := s.DoInto(ctx, &Request{Path: "/"}, &reply)
+		require.Error(err)
+		require.NotEqual(service.ErrCircuitOpen, err)
+	}
+
+	// nor the cancellation by the caller
+	calls = 0
+	s = newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 3 {
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+	s.Breaker = conf
+	for i := 0; i < 3; i++ {
+		cctx, cancel := context.WithCancel(ctx)
+		time.AfterFunc(10*time.Millisecond, cancel)
+		_, err := s.GetJSON(cctx, "/")
+		require.Error(err)
+		require.NotEqual(service.ErrCircuitOpen, err)
+	}
+	_, err := s.GetJSON(ctx, "/")
+	require.NoError(err)
+
+	// 5xx opens the circuit
+	calls = 0
+	s = newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	s.Breaker = conf
+	for i := 0; i < 2; i++ {
+		_, err = s.GetJSON(ctx, "/")
+		require.IsType(&StatusError{}, err)
+	}
+	_, err = s.GetJSON(ctx, "/")
+	require.Equal(service.ErrCircuitOpen, err)
+	require.Equal(int32(2), atomic.LoadInt32(&calls))
+
+	// classified by the service
+	calls = 0
+	s = newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	})
+	s.Breaker = conf
+	s.BreakerClassify = service.Classify
+	for i := 0; i < 2; i++ {
+		_, _ = s.GetJSON(ctx, "/")
+	}
+	_, err = s.GetJSON(ctx, "/")
+	require.Equal(service.ErrCircuitOpen, err)
+}
@@ -0,0 +1,343 @@
+package http
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skyandong/util/service"
+)
+
+// CacheEntry of a GET response
+type CacheEntry struct {
+	// Data of the response body
+	Data []byte `json:"data"`
+	// ContentType of the response
+	ContentType string `json:"contentType,omitempty"`
+	// ETag for revalidation
+	ETag string `json:"etag,omitempty"`
+	// Expires is the time until the entry is fresh
+	Expires time.Time `json:"expires"`
+}
+
+// CacheStore for GET responses
+type CacheStore interface {
+	// Get the entry of key
+	Get(ctx context.Context, key string) (e *CacheEntry, ok bool, err error)
+	// Set the entry of key, it can be dropped after ttl
+	Set(ctx context.Context, key string, e *CacheEntry, ttl time.Duration) error
+}
+
+const defaultCacheSize = 1024
+
+var (
+	cacheStores    = map[string]CacheStore{}
+	cacheStoresMtx sync.RWMutex
+	flights        = map[string]*flight{}
+	flightsMtx     sync.Mutex
+)
+
+// flight of a collapsed fetch, canceled when all its waiters are gone
+type flight struct {
+	cancel  context.CancelFunc
+	waiters int
+	done    chan struct{}
+	rsp     *response
+	err     error
+}
+
+// detached context keeps the values but not the deadline and cancellation
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+// RegisterCacheStore by name for CacheConf.Store
+func RegisterCacheStore(name string, store CacheStore) {
+	cacheStoresMtx.Lock()
+	defer cacheStoresMtx.Unlock()
+	cacheStores[name] = store
+}
+
+// getCacheStore of the service, creates the default LRU if not exist
+func getCacheStore(s Service) CacheStore {
+	name := s.Cache.Store
+	if name == "" {
+		name = "lru://" + service.Service(s).String()
+	}
+	cacheStoresMtx.RLock()
+	store, ok := cacheStores[name]
+	cacheStoresMtx.RUnlock()
+	if ok || s.Cache.Store != "" {
+		return store
+	}
+	cacheStoresMtx.Lock()
+	defer cacheStoresMtx.Unlock()
+	if store, ok = cacheStores[name]; !ok {
+		size := s.Cache.Size
+		if size <= 0 {
+			size = defaultCacheSize
+		}
+		store = NewLRUCacheStore(size)
+		cacheStores[name] = store
+	}
+	return store
+}
+
+// cached GET with revalidation, concurrent identical requests are collapsed
+func (s Service) cached(ctx context.Context, c *call) (*response, error) {
+	store := getCacheStore(s)
+	if store == nil {
+		log.Printf("cache store not registered: %s", s.Cache.Store)
+		return s.retried(ctx, c)
+	}
+	ts := time.Now()
+	key := s.cacheKey(ctx, c)
+	e, ok, err := store.Get(ctx, key)
+	if err != nil {
+		log.Printf("cache get %s error: %v", key, err)
+	}
+	if ok && time.Now().Before(e.Expires) {
+		rsp := e.response()
+		s.traceHit(ctx, c, ts, rsp, nil)
+		return rsp, nil
+	}
+
+	fetch := func(ctx context.Context) (*response, error) {
+		rc := c
+		if ok && e.ETag != "" {
+			rc = c.withHeader("If-None-Match", e.ETag)
+		}
+		rsp, err := s.retried(ctx, rc)
+		if err != nil {
+			return nil, err
+		}
+		if ok && rsp.status == http.StatusNotModified {
+			ne := *e
+			s.store(ctx, store, key, &ne, rsp.header)
+			return ne.response(), nil
+		}
+		ne := &CacheEntry{
+			Data:        rsp.data,
+			ContentType: rsp.header.Get("Content-Type"),
+			ETag:        rsp.header.Get("ETag"),
+		}
+		s.store(ctx, store, key, ne, rsp.header)
+		return rsp, nil
+	}
+	rsp, shared, err := collapse(ctx, key, fetch)
+	if shared {
+		s.traceHit(ctx, c, ts, rsp, err)
+	}
+	return rsp, err
+}
+
+// collapse concurrent fetches of key, the fetch runs on a context detached from the callers,
+// and is canceled when all of them are gone. shared is false for the caller starting the fetch
+func collapse(ctx context.Context, key string, fetch func(ctx context.Context) (*response, error)) (rsp *response, shared bool, err error) {
+	flightsMtx.Lock()
+	f, shared := flights[key]
+	if !shared {
+		fctx, cancel := context.WithCancel(detached{ctx})
+		f = &flight{cancel: cancel, done: make(chan struct{})}
+		flights[key] = f
+		go func() {
+			defer cancel()
+			f.rsp, f.err = fetch(fctx)
+			flightsMtx.Lock()
+			// a canceled flight may be replaced already
+			if flights[key] == f {
+				delete(flights, key)
+			}
+			flightsMtx.Unlock()
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	flightsMtx.Unlock()
+
+	select {
+	case <-f.done:
+		if f.err != nil {
+			return nil, shared, f.err
+		}
+		return f.rsp.clone(), shared, nil
+	case <-ctx.Done():
+		flightsMtx.Lock()
+		// new callers start another fetch instead of joining the canceled one
+		if f.waiters--; f.waiters <= 0 {
+			f.cancel()
+			if flights[key] == f {
+				delete(flights, key)
+			}
+		}
+		flightsMtx.Unlock()
+		return nil, shared, ctx.Err()
+	}
+}
+
+// traceHit of the call replied without its own request
+func (s Service) traceHit(ctx context.Context, c *call, ts time.Time, rsp *response, err error) {
+	svc := service.Service(s)
+	svc.DoTrace(service.WithCacheHit(ctx), svc, c.path, c.req.Body, traceReply(rsp), time.Now().Sub(ts), err)
+}
+
+// store the entry by the Cache-Control of header
+func (s Service) store(ctx context.Context, store CacheStore, key string, e *CacheEntry, header http.Header) {
+	fresh, ok := freshness(header.Get("Cache-Control"), s.Cache.TTL)
+	if !ok {
+		return
+	}
+	ttl := fresh
+	if e.ETag != "" {
+		ttl += s.Cache.MaxStale
+	}
+	if ttl <= 0 {
+		return
+	}
+	e.Expires = time.Now().Add(fresh)
+	if err := store.Set(ctx, key, e, ttl); err != nil {
+		log.Printf("cache set %s error: %v", key, err)
+	}
+}
+
+// cacheKey of the service, path and the selected headers
+func (s Service) cacheKey(ctx context.Context, c *call) string {
+	key := service.Service(s).String() + c.path
+	if len(s.Cache.Headers) <= 0 {
+		return key
+	}
+	extra := service.GetExtraHeaders(ctx)
+	hs := make([]string, 0, len(s.Cache.Headers))
+	for _, h := range s.Cache.Headers {
+		v := c.req.Header.Get(h)
+		if ev, ok := extra[h]; ok {
+			v = ev
+		}
+		hs = append(hs, http.CanonicalHeaderKey(h)+"="+v)
+	}
+	sort.Strings(hs)
+	return key + "#" + strings.Join(hs, "&")
+}
+
+// freshness by Cache-Control, false if must not store
+func freshness(cc string, ttl time.Duration) (time.Duration, bool) {
+	if cc == "" {
+		return ttl, true
+	}
+	fresh := ttl
+	for _, d := range strings.Split(cc, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		switch {
+		case d == "no-store":
+			return 0, false
+		case d == "no-cache":
+			fresh = 0
+		case strings.HasPrefix(d, "max-age="):
+			if n, err := strconv.Atoi(d[len("max-age="):]); err == nil {
+				fresh = time.Duration(n) * time.Second
+			}
+		}
+	}
+	return fresh, true
+}
+
+// response of the entry, the data is copied
+func (e *CacheEntry) response() *response {
+	h := http.Header{}
+	if e.ContentType != "" {
+		h.Set("Content-Type", e.ContentType)
+	}
+	data := make([]byte, len(e.Data))
+	copy(data, e.Data)
+	return &response{status: http.StatusOK, data: data, header: h}
+}
+
+// clone the response shared by collapsed callers
+func (r *response) clone() *response {
+	n := *r
+	n.data = make([]byte, len(r.data))
+	copy(n.data, r.data)
+	n.header = r.header.Clone()
+	return &n
+}
+
+// withHeader copies the call with an extra header
+func (c *call) withHeader(k, v string) *call {
+	r := *c.req
+	r.Header = r.Header.Clone()
+	if r.Header == nil {
+		r.Header = http.Header{}
+	}
+	r.Header.Set(k, v)
+	n := *c
+	n.req = &r
+	return &n
+}
+
+// lruStore in memory
+type lruStore struct {
+	lock  sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry *CacheEntry
+	until time.Time
+}
+
+// NewLRUCacheStore in memory with the max entries
+func NewLRUCacheStore(size int) CacheStore {
+	return &lruStore{
+		size:  size,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+func (l *lruStore) Get(_ context.Context, key string) (*CacheEntry, bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	el, ok := l.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	it := el.Value.(*lruItem)
+	if time.Now().After(it.until) {
+		l.ll.Remove(el)
+		delete(l.items, key)
+		return nil, false, nil
+	}
+	l.ll.MoveToFront(el)
+	return it.entry, true, nil
+}
+
+func (l *lruStore) Set(_ context.Context, key string, e *CacheEntry, ttl time.Duration) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	it := &lruItem{key: key, entry: e, until: time.Now().Add(ttl)}
+	if el, ok := l.items[key]; ok {
+		el.Value = it
+		l.ll.MoveToFront(el)
+		return nil
+	}
+	l.items[key] = l.ll.PushFront(it)
+	for l.ll.Len() > l.size {
+		el := l.ll.Back()
+		l.ll.Remove(el)
+		delete(l.items, el.Value.(*lruItem).key)
+	}
+	return nil
+}
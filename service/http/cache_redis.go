@@ -0,0 +1,62 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// redisStore on a pool of dbconf/redis
+type redisStore struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+// NewRedisCacheStore on the pool, such as redis.Conf.Get(name), keys are prefixed
+func NewRedisCacheStore(pool *redis.Pool, prefix string) CacheStore {
+	return &redisStore{pool: pool, prefix: prefix}
+}
+
+func (r *redisStore) Get(ctx context.Context, key string) (*CacheEntry, bool, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	data, err := redis.Bytes(conn.Do("GET", r.prefix+key))
+	if err == redis.ErrNil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	e := &CacheEntry{}
+	if err = json.Unmarshal(data, e); err != nil {
+		return nil, false, err
+	}
+	return e, true, nil
+}
+
+func (r *redisStore) Set(ctx context.Context, key string, e *CacheEntry, ttl time.Duration) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	ms := ttl.Milliseconds()
+	if ms <= 0 {
+		ms = 1
+	}
+	_, err = conn.Do("SET", r.prefix+key, data, "PX", ms)
+	return err
+}
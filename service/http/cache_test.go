@@ -0,0 +1,123 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skyandong/util/service"
+)
+
+func TestService_CacheCollapse(t *testing.T) {
+	require := require.New(t)
+	var calls int32
+	release := make(chan struct{})
+	s := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		_, _ = w.Write([]byte("data"))
+	})
+	var hits int32
+	s.Cache = &service.CacheConf{TTL: time.Minute}
+	s.Trace = func(ctx context.Context, svc service.Service, path string, req, reply interface{}, elapse time.Duration, err error) {
+		if service.IsCacheHit(ctx) {
+			atomic.AddInt32(&hits, 1)
+		}
+	}
+
+	// the first caller gives up, the others still get the reply
+	first, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := s.GetJSON(first, "/collapse")
+		errs <- err
+	}()
+	require.Eventually(func() bool {
+		return atomic.LoadInt32(&calls) == 1
+	}, time.Second, time.Millisecond)
+
+	var wg sync.WaitGroup
+	replies := make([][]byte, 3)
+	for i := range replies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data, err := s.GetJSON(context.Background(), "/collapse")
+			require.NoError(err)
+			replies[i] = data
+		}(i)
+	}
+	require.Eventually(func() bool {
+		flightsMtx.Lock()
+		defer flightsMtx.Unlock()
+		for _, f := range flights {
+			return f.waiters == 4
+		}
+		return false
+	}, time.Second, time.Millisecond)
+	cancel()
+	require.Equal(context.Canceled, <-errs)
+	close(release)
+	wg.Wait()
+	require.Equal(int32(1), atomic.LoadInt32(&calls))
+
+	// replies are copies
+	replies[0][0] = 'X'
+	require.Equal("data", string(replies[1]))
+	data, err := s.GetJSON(context.Background(), "/collapse")
+	require.NoError(err)
+	require.Equal("data", string(data))
+	require.Equal(int32(1), atomic.LoadInt32(&calls))
+	// collapsed callers and the cache hit
+	require.Equal(int32(4), atomic.LoadInt32(&hits))
+}
+
+func TestService_CacheCollapseCanceled(t *testing.T) {
+	require := require.New(t)
+	canceled := make(chan struct{})
+	s := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(canceled)
+	})
+	s.Cache = &service.CacheConf{TTL: time.Minute}
+
+	// the fetch is canceled when all callers are gone
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := s.GetJSON(ctx, "/slow")
+	require.Equal(context.DeadlineExceeded, err)
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("fetch not canceled")
+	}
+}
+
+func TestService_CacheCollapseAfterCanceled(t *testing.T) {
+	require := require.New(t)
+	var calls int32
+	s := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// the first fetch ends long after it is canceled
+			time.Sleep(200 * time.Millisecond)
+			return
+		}
+		_, _ = w.Write([]byte("data"))
+	})
+	s.Cache = &service.CacheConf{TTL: time.Minute}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := s.GetJSON(ctx, "/slow")
+	require.Equal(context.DeadlineExceeded, err)
+
+	// not joining the canceled fetch
+	data, err := s.GetJSON(context.Background(), "/slow")
+	require.NoError(err)
+	require.Equal("data", string(data))
+}
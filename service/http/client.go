@@ -1,7 +1,17 @@
 package http
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"sync"
 	"time"
 
@@ -16,6 +26,14 @@ type ClientCache struct {
 	idleTimeout time.Duration
 }
 
+const (
+	defaultDialTimeout = 30 * time.Second
+	defaultKeepAlive   = 30 * time.Second
+)
+
+// ErrInvalidCA means no certificate found in the CA file
+var ErrInvalidCA = errors.New("no certificate in ca file")
+
 // DefaultClientCache ...
 var DefaultClientCache *ClientCache
 
@@ -37,10 +55,21 @@ func NewClientCache(maxIdleConn int, idleTimeout time.Duration) *ClientCache {
 	}
 }
 
-// Get a HTTP client
+// Get a HTTP client, the default transport is used if the transport config is invalid
 func (m *ClientCache) Get(s Service) *http.Client {
+	c, err := m.Client(s)
+	if err != nil {
+		log.Printf("invalid transport of %s: %v", service.Service(s).String(), err)
+		s.Transport = nil
+		c, _ = m.Client(s)
+	}
+	return c
+}
+
+// Client returns the HTTP client of the service, created by its transport config at the first time
+func (m *ClientCache) Client(s Service) (*http.Client, error) {
 	// service key
-	key := service.Service(s).String()
+	key := m.key(s)
 
 	// get from cache
 	m.lock.RLock()
@@ -50,19 +79,137 @@ func (m *ClientCache) Get(s Service) *http.Client {
 	// not found
 	if !ok {
 		m.lock.Lock()
+		defer m.lock.Unlock()
 
 		// try get again
 		c, ok = m.cache[key]
 		if !ok {
-			c = &http.Client{
-				Transport: &http.Transport{
-					MaxIdleConns:    m.maxIdleConn,
-					IdleConnTimeout: m.idleTimeout,
-				},
+			var err error
+			c, err = m.newClient(s.Transport)
+			if err != nil {
+				return nil, err
 			}
 			m.cache[key] = c
 		}
-		m.lock.Unlock()
 	}
-	return c
+	return c, nil
+}
+
+// CloseIdle closes the idle connections of the service's client
+func (m *ClientCache) CloseIdle(s Service) {
+	m.lock.RLock()
+	c, ok := m.cache[m.key(s)]
+	m.lock.RUnlock()
+	if ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// Evict the service's client from cache and close its idle connections,
+// a new client will be created by the next request
+func (m *ClientCache) Evict(s Service) {
+	key := m.key(s)
+	m.lock.Lock()
+	c, ok := m.cache[key]
+	delete(m.cache, key)
+	m.lock.Unlock()
+	if ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// key of the service and its transport config, a client is shared by the same ones
+func (m *ClientCache) key(s Service) string {
+	key := service.Service(s).String()
+	if s.Transport == nil {
+		return key
+	}
+	data, _ := json.Marshal(s.Transport)
+	h := fnv.New64a()
+	_, _ = h.Write(data)
+	return key + "#" + strconv.FormatUint(h.Sum64(), 16)
+}
+
+func (m *ClientCache) newClient(tc *service.TransportConf) (*http.Client, error) {
+	if tc == nil {
+		tc = &service.TransportConf{}
+	}
+	dialer := &net.Dialer{
+		Timeout:   tc.DialTimeout,
+		KeepAlive: tc.KeepAlive,
+	}
+	if dialer.Timeout <= 0 {
+		dialer.Timeout = defaultDialTimeout
+	}
+	if dialer.KeepAlive == 0 {
+		dialer.KeepAlive = defaultKeepAlive
+	}
+	t := &http.Transport{
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          tc.MaxIdleConns,
+		MaxIdleConnsPerHost:   tc.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       tc.MaxConnsPerHost,
+		IdleConnTimeout:       tc.IdleConnTimeout,
+		TLSHandshakeTimeout:   tc.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: tc.ResponseHeaderTimeout,
+		// a custom dialer or tls config disables HTTP/2 unless forced
+		ForceAttemptHTTP2: !tc.DisableHTTP2,
+	}
+	if tc.DisableHTTP2 {
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	if t.MaxIdleConns <= 0 {
+		t.MaxIdleConns = m.maxIdleConn
+	}
+	if t.IdleConnTimeout <= 0 {
+		t.IdleConnTimeout = m.idleTimeout
+	}
+	switch tc.Proxy {
+	case "":
+	case "env":
+		t.Proxy = http.ProxyFromEnvironment
+	default:
+		u, err := url.Parse(tc.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+	if tc.TLS != nil {
+		cfg, err := newTLSConfig(tc.TLS)
+		if err != nil {
+			return nil, err
+		}
+		t.TLSClientConfig = cfg
+	}
+	return &http.Client{
+		Transport: t,
+		Timeout:   tc.Timeout,
+	}, nil
+}
+
+func newTLSConfig(c *service.TLSConf) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, ErrInvalidCA
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
 }
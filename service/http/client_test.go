@@ -0,0 +1,64 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skyandong/util/service"
+)
+
+func TestClientCache_Key(t *testing.T) {
+	require := require.New(t)
+	cc := NewClientCache(10, time.Second)
+	s := Service{Type: Origin, Name: "example.com"}
+	c0, err := cc.Client(s)
+	require.NoError(err)
+
+	s.Transport = &service.TransportConf{Timeout: time.Second}
+	c1, err := cc.Client(s)
+	require.NoError(err)
+	require.NotSame(c0, c1)
+	require.Equal(time.Second, c1.Timeout)
+
+	// same config shares the client
+	s.Transport = &service.TransportConf{Timeout: time.Second}
+	c2, err := cc.Client(s)
+	require.NoError(err)
+	require.Same(c1, c2)
+
+	s.Transport = &service.TransportConf{Timeout: 2 * time.Second}
+	c3, err := cc.Client(s)
+	require.NoError(err)
+	require.NotSame(c1, c3)
+	require.Equal(2*time.Second, c3.Timeout)
+}
+
+func TestClientCache_HTTP2(t *testing.T) {
+	require := require.New(t)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	s := Service{
+		Type:      Secure,
+		Name:      strings.TrimPrefix(ts.URL, "https://"),
+		Transport: &service.TransportConf{TLS: &service.TLSConf{InsecureSkipVerify: true}},
+	}
+	data, err := s.GetJSON(context.Background(), "/")
+	require.NoError(err)
+	require.Equal("HTTP/2.0", string(data))
+
+	s.Transport = &service.TransportConf{TLS: &service.TLSConf{InsecureSkipVerify: true}, DisableHTTP2: true}
+	data, err = s.GetJSON(context.Background(), "/")
+	require.NoError(err)
+	require.Equal("HTTP/1.1", string(data))
+}
@@ -0,0 +1,131 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"sync"
+
+	"github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec 按Content-Type编解码请求和响应体
+type Codec interface {
+	// ContentType 请求头中的Content-Type
+	ContentType() string
+	// Marshal v to data
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal data to v
+	Unmarshal(data []byte, v interface{}) error
+}
+
+const (
+	// MIMEJSON for json codec
+	MIMEJSON = "application/json"
+	// MIMEProtobuf for protobuf codec
+	MIMEProtobuf = "application/x-protobuf"
+	// MIMEMsgpack for msgpack codec
+	MIMEMsgpack = "application/x-msgpack"
+	// MIMEForm for url encoded form
+	MIMEForm = "application/x-www-form-urlencoded"
+)
+
+// ErrNotProtoMessage means the value is not a proto.Message
+var ErrNotProtoMessage = errors.New("not a proto message")
+
+var (
+	codecs    = map[string]Codec{}
+	codecsMtx sync.RWMutex
+)
+
+func init() {
+	RegisterCodec(jsonCodec{})
+	RegisterCodec(protoCodec{}, "application/protobuf")
+	RegisterCodec(newMsgpackCodec(), "application/msgpack")
+}
+
+// RegisterCodec by its media type and aliases
+func RegisterCodec(c Codec, aliases ...string) {
+	codecsMtx.Lock()
+	defer codecsMtx.Unlock()
+	codecs[mediaType(c.ContentType())] = c
+	for _, a := range aliases {
+		codecs[mediaType(a)] = c
+	}
+}
+
+// GetCodec by the content type, nil if not registered
+func GetCodec(contentType string) Codec {
+	codecsMtx.RLock()
+	defer codecsMtx.RUnlock()
+	return codecs[mediaType(contentType)]
+}
+
+// mediaType without parameters
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return mt
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return MIMEJSON + "; charset=utf-8"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type protoCodec struct{}
+
+func (protoCodec) ContentType() string {
+	return MIMEProtobuf
+}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+	return proto.Marshal(m)
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return ErrNotProtoMessage
+	}
+	return proto.Unmarshal(data, m)
+}
+
+type msgpackCodec struct {
+	handle *codec.MsgpackHandle
+}
+
+func newMsgpackCodec() msgpackCodec {
+	h := &codec.MsgpackHandle{}
+	h.RawToString = true
+	return msgpackCodec{handle: h}
+}
+
+func (msgpackCodec) ContentType() string {
+	return MIMEMsgpack
+}
+
+func (c msgpackCodec) Marshal(v interface{}) (data []byte, err error) {
+	err = codec.NewEncoderBytes(&data, c.handle).Encode(v)
+	return
+}
+
+func (c msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return codec.NewDecoderBytes(data, c.handle).Decode(v)
+}
@@ -0,0 +1,139 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/skyandong/util/service"
+)
+
+const (
+	// Gzip content encoding
+	Gzip = "gzip"
+	// Zstd content encoding
+	Zstd = "zstd"
+)
+
+// acceptEncoding when compression is configured
+const acceptEncoding = Zstd + ", " + Gzip
+
+var (
+	zstdEncoder     *zstd.Encoder
+	zstdDecoder     *zstd.Decoder
+	zstdEncoderOnce sync.Once
+	zstdDecoderOnce sync.Once
+	zstdEncoderErr  error
+	zstdDecoderErr  error
+)
+
+func getZstdEncoder() (*zstd.Encoder, error) {
+	zstdEncoderOnce.Do(func() {
+		zstdEncoder, zstdEncoderErr = zstd.NewWriter(nil)
+	})
+	return zstdEncoder, zstdEncoderErr
+}
+
+func getZstdDecoder() (*zstd.Decoder, error) {
+	zstdDecoderOnce.Do(func() {
+		zstdDecoder, zstdDecoderErr = zstd.NewReader(nil)
+	})
+	return zstdDecoder, zstdDecoderErr
+}
+
+// compress the replayable payload if it is large enough
+func compress(p *payload, conf *service.CompressConf) error {
+	if conf == nil || p.reader != nil || len(p.data) < conf.MinSize || len(p.data) <= 0 {
+		return nil
+	}
+	encoding := conf.Encoding
+	if encoding == "" {
+		encoding = Gzip
+	}
+	var data []byte
+	switch encoding {
+	case Gzip:
+		buf := &bytes.Buffer{}
+		w := gzip.NewWriter(buf)
+		if _, err := w.Write(p.data); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	case Zstd:
+		enc, err := getZstdEncoder()
+		if err != nil {
+			return err
+		}
+		data = enc.EncodeAll(p.data, nil)
+	default:
+		return fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+	p.rawSize = int64(len(p.data))
+	p.data = data
+	p.encoding = encoding
+	return nil
+}
+
+// decompress data by the content encoding
+func decompress(data []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", "identity":
+		return data, nil
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(r)
+	case Zstd:
+		dec, err := getZstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return dec.DecodeAll(data, nil)
+	}
+	return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+}
+
+// decompressReader of a stream body by the content encoding
+func decompressReader(body io.ReadCloser, encoding string) (io.ReadCloser, error) {
+	switch encoding {
+	case "", "identity":
+		return body, nil
+	case Gzip:
+		r, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressBody{Reader: r, body: body}, nil
+	case Zstd:
+		r, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressBody{Reader: r, body: body, close: r.Close}, nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+}
+
+// decompressBody closes the decoder and the origin body
+type decompressBody struct {
+	io.Reader
+	body  io.Closer
+	close func()
+}
+
+func (b *decompressBody) Close() error {
+	if b.close != nil {
+		b.close()
+	}
+	return b.body.Close()
+}
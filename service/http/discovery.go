@@ -0,0 +1,188 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/skyandong/util/consul"
+	"github.com/skyandong/util/service"
+)
+
+const (
+	// RoundRobin 轮询, 默认
+	RoundRobin = "round_robin"
+	// Random 随机
+	Random = "random"
+	// LeastInflight 最少进行中请求
+	LeastInflight = "least_inflight"
+)
+
+var (
+	// ErrNoInstance means no passing instance of the service
+	ErrNoInstance = errors.New("no passing instance")
+	// errUnreachable means the consul agent is unreachable
+	errUnreachable = errors.New("consul agent unreachable")
+)
+
+// discoveryWait for the first query of a service
+const discoveryWait = time.Second
+
+type instance struct {
+	addr     string
+	inflight int32
+}
+
+// discovery caches the passing instances of a service
+type discovery struct {
+	lock      sync.RWMutex
+	instances []*instance
+	err       error
+	ready     chan struct{}
+	once      sync.Once
+	next      uint32
+	cancel    context.CancelFunc
+}
+
+var (
+	discoveries    = map[string]*discovery{}
+	discoveriesMtx sync.Mutex
+)
+
+// discoveryKey of the service name and the conf
+func discoveryKey(name string, c *service.DiscoveryConf) string {
+	if c == nil {
+		return name
+	}
+	tags := append([]string(nil), c.Tags...)
+	sort.Strings(tags)
+	return strings.Join([]string{name, c.Agent, c.Datacenter, strings.Join(tags, ",")}, "|")
+}
+
+// getDiscovery returns the discovery of name, starts watching if not exist
+func getDiscovery(name string, c *service.DiscoveryConf) *discovery {
+	key := discoveryKey(name, c)
+	discoveriesMtx.Lock()
+	defer discoveriesMtx.Unlock()
+	d, ok := discoveries[key]
+	if !ok {
+		wc := &consul.WatchConf{
+			Name:  name,
+			Agent: &consul.AgentConf{Address: localIP + ":8500"},
+		}
+		if c != nil {
+			if c.Agent != "" {
+				wc.Agent.Address = c.Agent
+			}
+			wc.Tags = c.Tags
+			wc.Datacenter = c.Datacenter
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		d = &discovery{ready: make(chan struct{}), cancel: cancel}
+		discoveries[key] = d
+		go wc.Watch(ctx, d.update)
+	}
+	return d
+}
+
+// CloseDiscovery stops watching the instances of the service name, restarted at the next request
+func CloseDiscovery(name string) {
+	discoveriesMtx.Lock()
+	defer discoveriesMtx.Unlock()
+	for key, d := range discoveries {
+		if key == name || strings.HasPrefix(key, name+"|") {
+			d.cancel()
+			delete(discoveries, key)
+		}
+	}
+}
+
+// CloseDiscoveries stops watching all services
+func CloseDiscoveries() {
+	discoveriesMtx.Lock()
+	defer discoveriesMtx.Unlock()
+	for key, d := range discoveries {
+		d.cancel()
+		delete(discoveries, key)
+	}
+}
+
+func (d *discovery) update(ins []*consul.Instance, err error) {
+	defer d.once.Do(func() {
+		close(d.ready)
+	})
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err != nil {
+		// keep the instances got before
+		d.err = err
+		return
+	}
+	// keep inflight counters of the existing instances
+	old := make(map[string]*instance, len(d.instances))
+	for _, i := range d.instances {
+		old[i.addr] = i
+	}
+	instances := make([]*instance, 0, len(ins))
+	for _, i := range ins {
+		addr := i.HostPort()
+		if o, ok := old[addr]; ok {
+			instances = append(instances, o)
+		} else {
+			instances = append(instances, &instance{addr: addr})
+		}
+	}
+	d.instances = instances
+	d.err = nil
+}
+
+// pick an instance by the balance, release must be called after the request finished
+func (d *discovery) pick(ctx context.Context, balance string) (addr string, release func(), err error) {
+	t := time.NewTimer(discoveryWait)
+	defer t.Stop()
+	select {
+	case <-d.ready:
+	case <-t.C:
+		return "", nil, errUnreachable
+	case <-ctx.Done():
+		return "", nil, ctx.Err()
+	}
+
+	d.lock.RLock()
+	instances, e := d.instances, d.err
+	d.lock.RUnlock()
+	if len(instances) <= 0 {
+		if e != nil {
+			return "", nil, errUnreachable
+		}
+		return "", nil, ErrNoInstance
+	}
+
+	var i *instance
+	switch balance {
+	case Random:
+		i = instances[rand.Intn(len(instances))]
+	case LeastInflight:
+		// start from a rotating position to break ties
+		n := int(atomic.AddUint32(&d.next, 1))
+		for k := range instances {
+			c := instances[(n+k)%len(instances)]
+			if i == nil || atomic.LoadInt32(&c.inflight) < atomic.LoadInt32(&i.inflight) {
+				i = c
+			}
+		}
+	default:
+		n := int(atomic.AddUint32(&d.next, 1))
+		i = instances[n%len(instances)]
+	}
+	atomic.AddInt32(&i.inflight, 1)
+	release = func() {
+		atomic.AddInt32(&i.inflight, -1)
+	}
+	return i.addr, release, nil
+}
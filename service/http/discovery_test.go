@@ -0,0 +1,115 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skyandong/util/service"
+)
+
+// fakeAgent answers the consul health queries with the hosts set
+type fakeAgent struct {
+	lock  sync.Mutex
+	hosts []string
+	index uint64
+	tags  []string
+}
+
+func (a *fakeAgent) set(hosts ...string) {
+	a.lock.Lock()
+	a.hosts = hosts
+	a.index++
+	a.lock.Unlock()
+}
+
+func (a *fakeAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// blocking query, a short wait is enough for tests
+	if r.URL.Query().Get("index") != "" {
+		time.Sleep(10 * time.Millisecond)
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.tags = r.URL.Query()["tag"]
+	var entries []map[string]interface{}
+	for i, h := range a.hosts {
+		host, port, _ := net.SplitHostPort(h)
+		p, _ := strconv.Atoi(port)
+		entries = append(entries, map[string]interface{}{
+			"Node":    map[string]interface{}{"Address": host},
+			"Service": map[string]interface{}{"ID": strconv.Itoa(i), "Port": p},
+		})
+	}
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(a.index, 10))
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+func TestService_ConsulDirect(t *testing.T) {
+	require := require.New(t)
+	t.Cleanup(CloseDiscoveries)
+	var hosts []string
+	for i := 0; i < 2; i++ {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.Host))
+		}))
+		defer ts.Close()
+		hosts = append(hosts, strings.TrimPrefix(ts.URL, "http://"))
+	}
+	agent := &fakeAgent{}
+	agent.set(hosts...)
+	as := httptest.NewServer(agent)
+	defer as.Close()
+
+	s := Service{
+		Type: ConsulDirect,
+		Name: "echo",
+		Discovery: &service.DiscoveryConf{
+			Agent: strings.TrimPrefix(as.URL, "http://"),
+			Tags:  []string{"v1"},
+		},
+	}
+	ctx := context.Background()
+	got := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		data, err := s.GetJSON(ctx, "/")
+		require.NoError(err)
+		got[string(data)] = true
+	}
+	require.Equal(map[string]bool{hosts[0]: true, hosts[1]: true}, got)
+	agent.lock.Lock()
+	require.Equal([]string{"v1"}, agent.tags)
+	agent.lock.Unlock()
+
+	// changes are watched
+	agent.set(hosts[1])
+	require.Eventually(func() bool {
+		for i := 0; i < 2; i++ {
+			if data, err := s.GetJSON(ctx, "/"); err != nil || string(data) != hosts[1] {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 10*time.Millisecond)
+
+	agent.set()
+	require.Eventually(func() bool {
+		_, err := s.GetJSON(ctx, "/")
+		return err == ErrNoInstance
+	}, time.Second, 10*time.Millisecond)
+
+	// restarted after closed
+	CloseDiscovery("echo")
+	agent.set(hosts[0])
+	data, err := s.GetJSON(ctx, "/")
+	require.NoError(err)
+	require.Equal(hosts[0], string(data))
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/skyandong/util/service"
+)
+
+// maxErrorBody kept in StatusError
+const maxErrorBody = 4096
+
+// StatusError for the status code not accepted
+type StatusError struct {
+	// StatusCode of the response
+	StatusCode int
+	// Header of the response
+	Header http.Header
+	// Body of the response, at most 4KB
+	Body []byte
+	// URL resolved for the request
+	URL string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status code: %d, url: %s", e.StatusCode, e.URL)
+}
+
+// RetryAfter in the header, 0 if not set
+func (e *StatusError) RetryAfter() time.Duration {
+	v := e.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if n, err := strconv.Atoi(v); err == nil && n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// accepted returns whether code matches one of codes like "200" or "2xx", only 200 if codes is empty
+func accepted(codes []string, code int) bool {
+	if len(codes) <= 0 {
+		return code == http.StatusOK
+	}
+	s := strconv.Itoa(code)
+	for _, c := range codes {
+		if len(c) != len(s) {
+			continue
+		}
+		matched := true
+		for i := range c {
+			if c[i] != s[i] && c[i] != 'x' && c[i] != 'X' {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// classify the errors for breakers, only transport errors, 5xx and 429 are failures,
+// the cancellation by the caller is ignored
+func classify(err error) service.BreakerResult {
+	switch {
+	case err == nil:
+		return service.ResultSuccess
+	case errors.Is(err, context.Canceled):
+		return service.ResultIgnored
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		if se.StatusCode >= http.StatusInternalServerError || se.StatusCode == http.StatusTooManyRequests {
+			return service.ResultFailure
+		}
+		return service.ResultSuccess
+	}
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		return service.ResultFailure
+	}
+	return service.ResultSuccess
+}
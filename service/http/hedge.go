@@ -0,0 +1,198 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/skyandong/util/service"
+)
+
+const (
+	defaultHedgeDelay = 100 * time.Millisecond
+	// excludeTries of resolving another endpoint for the hedged request
+	excludeTries = 3
+	// latencySamples kept for the percentile
+	latencySamples = 128
+)
+
+// errSameEndpoint means no endpoint other than the first request's, the hedged request is not sent
+var errSameEndpoint = errors.New("no other endpoint to hedge")
+
+type (
+	recordKey  struct{}
+	excludeKey struct{}
+)
+
+// hedgeHost resolved by the first request
+type hedgeHost struct {
+	lock sync.Mutex
+	host string
+}
+
+// recordHost of the request if it is the first of hedging
+func recordHost(ctx context.Context, host string) {
+	if h, ok := ctx.Value(recordKey{}).(*hedgeHost); ok {
+		h.lock.Lock()
+		h.host = host
+		h.lock.Unlock()
+	}
+}
+
+// excludedHost by the hedged request
+func excludedHost(ctx context.Context) string {
+	host, _ := ctx.Value(excludeKey{}).(string)
+	return host
+}
+
+// latency of recent successful requests
+type latency struct {
+	lock    sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+var (
+	latencies    = map[string]*latency{}
+	latenciesMtx sync.Mutex
+)
+
+func getLatency(key string) *latency {
+	latenciesMtx.Lock()
+	defer latenciesMtx.Unlock()
+	l, ok := latencies[key]
+	if !ok {
+		l = &latency{samples: make([]time.Duration, 0, latencySamples)}
+		latencies[key] = l
+	}
+	return l
+}
+
+func (l *latency) add(d time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if len(l.samples) < latencySamples {
+		l.samples = append(l.samples, d)
+		return
+	}
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % latencySamples
+}
+
+// percentile of the samples, false if not enough samples
+func (l *latency) percentile(p float64) (time.Duration, bool) {
+	l.lock.Lock()
+	if len(l.samples) < latencySamples/4 {
+		l.lock.Unlock()
+		return 0, false
+	}
+	s := make([]time.Duration, len(l.samples))
+	copy(s, l.samples)
+	l.lock.Unlock()
+	sort.Slice(s, func(i, j int) bool {
+		return s[i] < s[j]
+	})
+	i := int(float64(len(s)) * p)
+	if i >= len(s) {
+		i = len(s) - 1
+	}
+	return s[i], true
+}
+
+// hedger sends a duplicate request after a delay and takes the first success
+type hedger struct {
+	s       Service
+	c       *call
+	conf    *service.HedgeConf
+	latency *latency
+}
+
+type hedgeResult struct {
+	rsp *response
+	err error
+}
+
+func newHedger(s Service, c *call) *hedger {
+	if s.Hedge == nil || c.stream || !c.p.replayable() {
+		return nil
+	}
+	switch c.method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		return nil
+	}
+	return &hedger{
+		s:       s,
+		c:       c,
+		conf:    s.Hedge,
+		latency: getLatency(service.Service(s).String()),
+	}
+}
+
+func (h *hedger) delay() time.Duration {
+	d := h.conf.Delay
+	if h.conf.Percentile > 0 {
+		if p, ok := h.latency.percentile(h.conf.Percentile); ok {
+			d = p
+		}
+		if d < h.conf.MinDelay {
+			d = h.conf.MinDelay
+		}
+	}
+	if d <= 0 {
+		d = defaultHedgeDelay
+	}
+	return d
+}
+
+// do the request, the hedged one goes to another endpoint,
+// the loser is canceled, both are traced
+func (h *hedger) do(ctx context.Context) (*response, error) {
+	hctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	first := &hedgeHost{}
+	ch := make(chan hedgeResult, 2)
+	run := func(ctx context.Context) {
+		ts := time.Now()
+		rsp, err := h.s.traced(ctx, h.c)
+		if err == nil {
+			h.latency.add(time.Now().Sub(ts))
+		}
+		ch <- hedgeResult{rsp: rsp, err: err}
+	}
+	go run(context.WithValue(hctx, recordKey{}, first))
+
+	t := time.NewTimer(h.delay())
+	defer t.Stop()
+	pending, hedged := 1, false
+	var err error
+	for {
+		select {
+		case <-t.C:
+			if !hedged {
+				hedged = true
+				pending++
+				first.lock.Lock()
+				host := first.host
+				first.lock.Unlock()
+				go run(context.WithValue(service.WithHedged(hctx), excludeKey{}, host))
+			}
+		case r := <-ch:
+			pending--
+			if r.err == nil {
+				return r.rsp, nil
+			}
+			// the hedged one not sent is not the error of the call
+			if err == nil || errors.Is(err, errSameEndpoint) {
+				err = r.err
+			}
+			// the first failed before hedging, leave it to retries
+			if pending == 0 {
+				return nil, err
+			}
+		}
+	}
+}
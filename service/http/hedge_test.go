@@ -0,0 +1,123 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skyandong/util/service"
+)
+
+type hedgeTrace struct {
+	hedged bool
+	err    error
+}
+
+func TestService_Hedge(t *testing.T) {
+	require := require.New(t)
+	var calls int32
+	canceled := make(chan struct{}, 1)
+	h := func(w http.ResponseWriter, r *http.Request) {
+		// the first request is slow
+		if atomic.AddInt32(&calls, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+				canceled <- struct{}{}
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		_, _ = w.Write([]byte(r.Host))
+	}
+	var hosts []string
+	for i := 0; i < 2; i++ {
+		ts := httptest.NewServer(http.HandlerFunc(h))
+		defer ts.Close()
+		hosts = append(hosts, strings.TrimPrefix(ts.URL, "http://"))
+	}
+	RegisterResolver("hedge-test", ResolverFunc(func(ctx context.Context, name string) ([]Endpoint, error) {
+		return []Endpoint{{Host: hosts[0]}, {Host: hosts[1]}}, nil
+	}))
+
+	var lock sync.Mutex
+	var traces []hedgeTrace
+	s := Service{Type: "hedge-test", Name: "echo", Hedge: &service.HedgeConf{Delay: 20 * time.Millisecond}}
+	s.Trace = func(ctx context.Context, svc service.Service, path string, req, reply interface{}, elapse time.Duration, err error) {
+		lock.Lock()
+		traces = append(traces, hedgeTrace{hedged: service.IsHedged(ctx), err: err})
+		lock.Unlock()
+	}
+
+	ts := time.Now()
+	data, err := s.GetJSON(context.Background(), "/")
+	require.NoError(err)
+	require.True(time.Since(ts) < 500*time.Millisecond)
+	require.Equal(int32(2), atomic.LoadInt32(&calls))
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("loser not canceled")
+	}
+
+	require.Eventually(func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(traces) == 2
+	}, time.Second, time.Millisecond)
+	// the winner goes to another instance
+	require.True(traces[0].hedged)
+	require.NoError(traces[0].err)
+	require.Contains(hosts, string(data))
+	require.False(traces[1].hedged)
+	require.Error(traces[1].err)
+}
+
+func TestService_HedgeSingleEndpoint(t *testing.T) {
+	require := require.New(t)
+	var calls int32
+	s := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+	})
+	var traces int32
+	s.Hedge = &service.HedgeConf{Delay: 5 * time.Millisecond}
+	s.Trace = func(ctx context.Context, svc service.Service, path string, req, reply interface{}, elapse time.Duration, err error) {
+		atomic.AddInt32(&traces, 1)
+	}
+
+	_, err := s.GetJSON(context.Background(), "/")
+	require.NoError(err)
+	require.Equal(int32(1), atomic.LoadInt32(&calls))
+	require.Equal(int32(1), atomic.LoadInt32(&traces))
+}
+
+func TestService_HedgeSingleEndpointFailed(t *testing.T) {
+	require := require.New(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+	RegisterResolver("hedge-failed-test", ResolverFunc(func(ctx context.Context, name string) ([]Endpoint, error) {
+		// the hedged one finds no other endpoint after the first failed
+		if service.IsHedged(ctx) {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return []Endpoint{{Host: host}}, nil
+	}))
+
+	s := Service{Type: "hedge-failed-test", Name: "echo", Hedge: &service.HedgeConf{Delay: 5 * time.Millisecond}}
+	_, err := s.GetJSON(context.Background(), "/")
+	var se *StatusError
+	require.True(errors.As(err, &se), err)
+	require.Equal(http.StatusServiceUnavailable, se.StatusCode)
+}
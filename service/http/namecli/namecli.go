@@ -1,22 +1,23 @@
 package namecli
 
 import (
-	"bytes"
 	"context"
-	"errors"
-	"fmt"
-	"net"
 	"os"
-	"strconv"
 	"strings"
-	"sync/atomic"
+	"sync"
 	"time"
 )
 
 var (
 	// Addr agent addr
 	Addr string
-	seq  uint32
+	// Addrs of agents for failover, Addr is used if empty
+	Addrs []string
+	// DefaultTTL of the resolved addrs
+	DefaultTTL = 10 * time.Second
+
+	defaultResolver    *Resolver
+	defaultResolverMtx sync.RWMutex
 )
 
 func init() {
@@ -29,69 +30,40 @@ func init() {
 	Addr = ip + ":8328"
 }
 
-// Name resolve a service name to addr
-func Name(ctx context.Context, name string) (addr string, err error) {
-	if !strings.HasSuffix(name, ".ns") {
-		return name, nil
-	}
-
-	timeout := time.Duration(0)
-	retried := false
-	deadline, ok := ctx.Deadline()
-	if ok {
-		timeout = deadline.Sub(time.Now())
+// DefaultResolver on Addrs or Addr, created at the first use
+func DefaultResolver() *Resolver {
+	defaultResolverMtx.RLock()
+	r := defaultResolver
+	defaultResolverMtx.RUnlock()
+	if r != nil {
+		return r
 	}
-again:
-	conn, err := net.DialTimeout("udp", Addr, timeout)
-	if err != nil {
-		return
-	}
-	defer func() {
-		_ = conn.Close()
-	}()
-	err = conn.SetDeadline(deadline)
-	if err != nil {
-		return
-	}
-
-	seq := atomic.AddUint32(&seq, 1)
-	req := fmt.Sprintf("%d,%s", seq, name)
-	_, err = conn.Write([]byte(req))
-	if err != nil {
-		return
-	}
-
-	rsp := [64]byte{}
-	n, err := conn.Read(rsp[:])
-	if err != nil || n <= 0 {
-		return
-	}
-
-	_rsp := rsp[:n]
-	i := bytes.IndexByte(_rsp, ',')
-	if i == -1 {
-		// no expected
-		return
-	}
-	_seq, _ := strconv.ParseUint(string(_rsp[:i]), 10, 32)
-	if seq != uint32(_seq) {
-		if !retried {
-			retried = true
-			goto again
+	defaultResolverMtx.Lock()
+	defer defaultResolverMtx.Unlock()
+	if defaultResolver == nil {
+		addrs := Addrs
+		if len(addrs) <= 0 {
+			addrs = []string{Addr}
 		}
-		err = errors.New("seq invalid from namesrv")
-		return
+		defaultResolver = NewResolverWithOptions(ResolverOptions{
+			Addrs: addrs,
+			TTL:   DefaultTTL,
+		})
 	}
+	return defaultResolver
+}
 
-	addr = string(_rsp[i+1:])
-	if addr == "" {
-		if !retried {
-			retried = true
-			goto again
-		}
-		err = fmt.Errorf("no addr found from namesrv: %s", name)
-		return
-	}
+// SetDefaultResolver replaces the default resolver, like one on namesrvtest.Server in tests,
+// the previous one is returned and not closed, nil if not created
+func SetDefaultResolver(r *Resolver) *Resolver {
+	defaultResolverMtx.Lock()
+	defer defaultResolverMtx.Unlock()
+	prev := defaultResolver
+	defaultResolver = r
+	return prev
+}
 
-	return
+// Name resolve a service name to addr
+func Name(ctx context.Context, name string) (addr string, err error) {
+	return DefaultResolver().Name(ctx, name)
 }
@@ -0,0 +1,174 @@
+// Package namesrvtest provides an in-process namesrv agent for tests.
+package namesrvtest
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxQuery size of a udp query
+const maxQuery = 1024
+
+// Server speaks the "seq,name" -> "seq,addr1,addr2" protocol on a local udp port,
+// unknown names are answered with no addr
+type Server struct {
+	// Addr of the server, like "127.0.0.1:port"
+	Addr string
+
+	conn *net.UDPConn
+	wg   sync.WaitGroup
+
+	lock     sync.Mutex
+	names    map[string][]string
+	drops    map[string]int
+	delays   map[string]time.Duration
+	wrongSeq map[string]int
+	queries  map[string]int
+	closed   bool
+}
+
+// NewServer listens on a random local port and starts serving
+func NewServer() (*Server, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Addr:     conn.LocalAddr().String(),
+		conn:     conn,
+		names:    map[string][]string{},
+		drops:    map[string]int{},
+		delays:   map[string]time.Duration{},
+		wrongSeq: map[string]int{},
+		queries:  map[string]int{},
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Set the addrs of a name
+func (s *Server) Set(name string, addrs ...string) {
+	s.lock.Lock()
+	s.names[name] = addrs
+	s.lock.Unlock()
+}
+
+// Delete the addrs of a name
+func (s *Server) Delete(name string) {
+	s.lock.Lock()
+	delete(s.names, name)
+	s.lock.Unlock()
+}
+
+// Drop the next n queries of a name without response, n < 0 drops all
+func (s *Server) Drop(name string, n int) {
+	s.lock.Lock()
+	s.drops[name] = n
+	s.lock.Unlock()
+}
+
+// Delay the responses of a name, 0 to clear
+func (s *Server) Delay(name string, d time.Duration) {
+	s.lock.Lock()
+	s.delays[name] = d
+	s.lock.Unlock()
+}
+
+// WrongSeq answers the next n queries of a name with another seq, n < 0 for all
+func (s *Server) WrongSeq(name string, n int) {
+	s.lock.Lock()
+	s.wrongSeq[name] = n
+	s.lock.Unlock()
+}
+
+// Queries received of a name, including the dropped ones
+func (s *Server) Queries(name string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.queries[name]
+}
+
+// Close the server, waits the delayed responses
+func (s *Server) Close() error {
+	s.lock.Lock()
+	s.closed = true
+	s.lock.Unlock()
+	err := s.conn.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	buf := make([]byte, maxQuery)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		seq, name, ok := parseQuery(buf[:n])
+		if !ok {
+			continue
+		}
+		rsp, delay, ok := s.answer(seq, name)
+		if !ok {
+			continue
+		}
+		if delay <= 0 {
+			_, _ = s.conn.WriteToUDP(rsp, addr)
+			continue
+		}
+		s.wg.Add(1)
+		time.AfterFunc(delay, func() {
+			defer s.wg.Done()
+			_, _ = s.conn.WriteToUDP(rsp, addr)
+		})
+	}
+}
+
+// answer a query by the programmed behaviors, ok is false if dropped
+func (s *Server) answer(seq uint64, name string) (rsp []byte, delay time.Duration, ok bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.queries[name]++
+	if s.closed || take(s.drops, name) {
+		return nil, 0, false
+	}
+	if take(s.wrongSeq, name) {
+		// far from the seqs in flight
+		seq = (seq + 1<<31) % (1 << 32)
+	}
+	rsp = []byte(fmt.Sprintf("%d,%s", seq, strings.Join(s.names[name], ",")))
+	return rsp, s.delays[name], true
+}
+
+// take one from the counter, negative counters are never exhausted
+func take(counters map[string]int, name string) bool {
+	n := counters[name]
+	if n == 0 {
+		return false
+	}
+	if n > 0 {
+		counters[name] = n - 1
+	}
+	return true
+}
+
+// parseQuery like "seq,name"
+func parseQuery(q []byte) (seq uint64, name string, ok bool) {
+	i := bytes.IndexByte(q, ',')
+	if i == -1 {
+		return
+	}
+	seq, err := strconv.ParseUint(string(q[:i]), 10, 32)
+	if err != nil {
+		return
+	}
+	return seq, strings.TrimSpace(string(q[i+1:])), true
+}
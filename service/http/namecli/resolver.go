@@ -0,0 +1,372 @@
+package namecli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxResponse size of a udp response
+	maxResponse = 4096
+	// staleFactor of ttl, entries older than it are resolved synchronously
+	staleFactor = 10
+)
+
+var (
+	// ErrNoAddr means namesrv returns no addr of the name
+	ErrNoAddr = errors.New("no addr found from namesrv")
+	// ErrSeqMismatch means only responses of other seqs are received before timeout
+	ErrSeqMismatch = errors.New("seq invalid from namesrv")
+	// ErrTimeout means no response is received within the attempt timeout
+	ErrTimeout = errors.New("namesrv timeout")
+	// ErrClosed means the resolver is closed
+	ErrClosed = errors.New("resolver closed")
+)
+
+// ResolverOptions for Resolver, zero values are replaced by defaults
+type ResolverOptions struct {
+	// Addrs of agents, the next one is used when the current fails
+	Addrs []string
+	// TTL of the resolved addrs
+	TTL time.Duration
+	// Timeout of an attempt, 300ms by default
+	Timeout time.Duration
+	// Retries after the first attempt, 2 by default, negative for no retry
+	Retries int
+	// Backoff before the first retry, doubled each time, 20ms by default
+	Backoff time.Duration
+}
+
+const (
+	defaultTimeout = 300 * time.Millisecond
+	defaultRetries = 2
+	defaultBackoff = 20 * time.Millisecond
+)
+
+// Resolver resolves names by the namesrv agents, with a TTL cache
+type Resolver struct {
+	opts    ResolverOptions
+	agents  []*agent
+	current uint32
+	seq     uint32
+
+	cacheLock sync.RWMutex
+	cache     map[string]*entry
+}
+
+// agent with a long-lived socket, responses are demultiplexed by seq
+type agent struct {
+	addr       string
+	lock       sync.Mutex
+	conn       net.Conn
+	pending    map[uint32]chan result
+	closed     bool
+	mismatches uint32
+}
+
+type result struct {
+	addrs []string
+	err   error
+}
+
+type entry struct {
+	addrs      []string
+	updated    time.Time
+	refreshing int32
+	next       uint32
+}
+
+// NewResolver on the agent addr, resolved addrs are cached for ttl
+func NewResolver(addr string, ttl time.Duration) *Resolver {
+	return NewResolverWithOptions(ResolverOptions{
+		Addrs: []string{addr},
+		TTL:   ttl,
+	})
+}
+
+// NewResolverWithOptions creates a resolver
+func NewResolverWithOptions(opts ResolverOptions) *Resolver {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.Retries == 0 {
+		opts.Retries = defaultRetries
+	} else if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = defaultBackoff
+	}
+	r := &Resolver{
+		opts:  opts,
+		cache: map[string]*entry{},
+	}
+	for _, addr := range opts.Addrs {
+		r.agents = append(r.agents, &agent{
+			addr:    addr,
+			pending: map[uint32]chan result{},
+		})
+	}
+	return r
+}
+
+// Name resolve a service name to one of its addrs in turn
+func (r *Resolver) Name(ctx context.Context, name string) (string, error) {
+	if !strings.HasSuffix(name, ".ns") {
+		return name, nil
+	}
+	e, err := r.lookup(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	n := atomic.AddUint32(&e.next, 1)
+	return e.addrs[int(n)%len(e.addrs)], nil
+}
+
+// Resolve a service name to all its addrs
+func (r *Resolver) Resolve(ctx context.Context, name string) ([]string, error) {
+	if !strings.HasSuffix(name, ".ns") {
+		return []string{name}, nil
+	}
+	e, err := r.lookup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return e.addrs, nil
+}
+
+// Close the sockets, pending queries fail
+func (r *Resolver) Close() (err error) {
+	for _, a := range r.agents {
+		if e := a.close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// lookup the cache, a stale entry is refreshed in background, or used if the query fails
+func (r *Resolver) lookup(ctx context.Context, name string) (*entry, error) {
+	r.cacheLock.RLock()
+	e, ok := r.cache[name]
+	r.cacheLock.RUnlock()
+	if ok {
+		age := time.Since(e.updated)
+		if age < r.opts.TTL {
+			return e, nil
+		}
+		if age < r.opts.TTL*staleFactor {
+			if atomic.CompareAndSwapInt32(&e.refreshing, 0, 1) {
+				go r.refresh(name)
+			}
+			return e, nil
+		}
+	}
+	ne, err := r.update(ctx, name)
+	if err != nil {
+		if ok {
+			return e, nil
+		}
+		return nil, err
+	}
+	return ne, nil
+}
+
+func (r *Resolver) refresh(name string) {
+	if _, err := r.update(context.Background(), name); err != nil {
+		// try again at the next lookup
+		r.cacheLock.RLock()
+		if e, ok := r.cache[name]; ok {
+			atomic.StoreInt32(&e.refreshing, 0)
+		}
+		r.cacheLock.RUnlock()
+	}
+}
+
+// update the cache by a query
+func (r *Resolver) update(ctx context.Context, name string) (*entry, error) {
+	addrs, err := r.query(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	e := &entry{addrs: addrs, updated: time.Now()}
+	r.cacheLock.Lock()
+	r.cache[name] = e
+	r.cacheLock.Unlock()
+	return e, nil
+}
+
+// query with retries, failing over to the next agent
+func (r *Resolver) query(ctx context.Context, name string) (addrs []string, err error) {
+	if len(r.agents) <= 0 {
+		return nil, fmt.Errorf("%w: no agent", ErrNoAddr)
+	}
+	backoff := r.opts.Backoff
+	for i := 0; ; i++ {
+		cur := atomic.LoadUint32(&r.current)
+		a := r.agents[int(cur)%len(r.agents)]
+		addrs, err = r.attempt(ctx, a, name)
+		if err == nil || ctx.Err() != nil || i >= r.opts.Retries {
+			return
+		}
+		// the agent fails, not the name
+		if !errors.Is(err, ErrNoAddr) {
+			atomic.CompareAndSwapUint32(&r.current, cur, cur+1)
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func (r *Resolver) attempt(ctx context.Context, a *agent, name string) ([]string, error) {
+	seq := atomic.AddUint32(&r.seq, 1)
+	ch := make(chan result, 1)
+	conn, err := a.register(seq, ch)
+	if err != nil {
+		return nil, err
+	}
+	defer a.unregister(seq)
+	mismatches := atomic.LoadUint32(&a.mismatches)
+
+	if _, err = conn.Write([]byte(fmt.Sprintf("%d,%s", seq, name))); err != nil {
+		a.reset(conn, err)
+		return nil, err
+	}
+	t := time.NewTimer(r.opts.Timeout)
+	defer t.Stop()
+	select {
+	case res := <-ch:
+		if res.err != nil {
+			return nil, res.err
+		}
+		if len(res.addrs) <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrNoAddr, name)
+		}
+		return res.addrs, nil
+	case <-t.C:
+		if atomic.LoadUint32(&a.mismatches) != mismatches {
+			return nil, ErrSeqMismatch
+		}
+		return nil, ErrTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// register a pending query, dials the socket if needed
+func (a *agent) register(seq uint32, ch chan result) (net.Conn, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.closed {
+		return nil, ErrClosed
+	}
+	if a.conn == nil {
+		conn, err := net.Dial("udp", a.addr)
+		if err != nil {
+			return nil, err
+		}
+		a.conn = conn
+		go a.read(conn)
+	}
+	a.pending[seq] = ch
+	return a.conn, nil
+}
+
+func (a *agent) unregister(seq uint32) {
+	a.lock.Lock()
+	delete(a.pending, seq)
+	a.lock.Unlock()
+}
+
+// read responses until the socket fails
+func (a *agent) read(conn net.Conn) {
+	buf := make([]byte, maxResponse)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			a.reset(conn, err)
+			return
+		}
+		seq, addrs, ok := parseResponse(buf[:n])
+		if !ok {
+			atomic.AddUint32(&a.mismatches, 1)
+			continue
+		}
+		a.lock.Lock()
+		ch, ok := a.pending[seq]
+		delete(a.pending, seq)
+		a.lock.Unlock()
+		// late response of a finished query, or a wrong seq
+		if !ok {
+			atomic.AddUint32(&a.mismatches, 1)
+			continue
+		}
+		ch <- result{addrs: addrs}
+	}
+}
+
+// reset the failed socket, pending queries fail with err
+func (a *agent) reset(conn net.Conn, err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.conn != conn {
+		return
+	}
+	_ = conn.Close()
+	a.conn = nil
+	a.fail(err)
+}
+
+func (a *agent) close() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.closed = true
+	a.fail(ErrClosed)
+	if a.conn == nil {
+		return nil
+	}
+	err := a.conn.Close()
+	a.conn = nil
+	return err
+}
+
+// fail the pending queries, lock must be held
+func (a *agent) fail(err error) {
+	for seq, ch := range a.pending {
+		ch <- result{err: err}
+		delete(a.pending, seq)
+	}
+}
+
+// parseResponse like "seq,addr1,addr2"
+func parseResponse(rsp []byte) (seq uint32, addrs []string, ok bool) {
+	i := bytes.IndexByte(rsp, ',')
+	if i == -1 {
+		return
+	}
+	s, err := strconv.ParseUint(string(rsp[:i]), 10, 32)
+	if err != nil {
+		return
+	}
+	addrs = strings.FieldsFunc(string(rsp[i+1:]), func(c rune) bool {
+		return c == ',' || c == ';' || c == ' ' || c == '\n' || c == '\r'
+	})
+	return uint32(s), addrs, true
+}
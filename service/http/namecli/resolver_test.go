@@ -0,0 +1,135 @@
+package namecli
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skyandong/util/service/http/namecli/namesrvtest"
+)
+
+func newTestServer(t *testing.T) *namesrvtest.Server {
+	s, err := namesrvtest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func newTestResolver(t *testing.T, opts ResolverOptions) *Resolver {
+	if opts.Timeout == 0 {
+		opts.Timeout = 50 * time.Millisecond
+	}
+	if opts.Backoff == 0 {
+		opts.Backoff = time.Millisecond
+	}
+	r := NewResolverWithOptions(opts)
+	t.Cleanup(func() { _ = r.Close() })
+	return r
+}
+
+func TestResolver_Name(t *testing.T) {
+	assert := assert.New(t)
+	s := newTestServer(t)
+	s.Set("a.ns", "10.0.0.1:80", "10.0.0.2:80")
+	r := newTestResolver(t, ResolverOptions{Addrs: []string{s.Addr}, TTL: time.Minute})
+	ctx := context.Background()
+
+	got := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		addr, err := r.Name(ctx, "a.ns")
+		assert.NoError(err)
+		got[addr] = true
+	}
+	assert.Equal(map[string]bool{"10.0.0.1:80": true, "10.0.0.2:80": true}, got)
+	assert.Equal(1, s.Queries("a.ns"), "cached")
+
+	addr, err := r.Name(ctx, "example.com:80")
+	assert.NoError(err)
+	assert.Equal("example.com:80", addr)
+
+	_, err = r.Name(ctx, "none.ns")
+	assert.True(errors.Is(err, ErrNoAddr), err)
+}
+
+func TestResolver_Errors(t *testing.T) {
+	assert := assert.New(t)
+	s := newTestServer(t)
+	s.Set("a.ns", "10.0.0.1:80")
+	r := newTestResolver(t, ResolverOptions{Addrs: []string{s.Addr}, Retries: -1})
+	ctx := context.Background()
+
+	s.Drop("a.ns", 1)
+	_, err := r.Resolve(ctx, "a.ns")
+	assert.Equal(ErrTimeout, err)
+
+	s.WrongSeq("a.ns", 1)
+	_, err = r.Resolve(ctx, "a.ns")
+	assert.Equal(ErrSeqMismatch, err)
+
+	s.Delay("a.ns", 200*time.Millisecond)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = r.Resolve(ctx, "a.ns")
+	assert.Equal(context.DeadlineExceeded, err)
+}
+
+func TestResolver_Retry(t *testing.T) {
+	require := require.New(t)
+	s := newTestServer(t)
+	s.Set("a.ns", "10.0.0.1:80")
+	s.Drop("a.ns", 2)
+	r := newTestResolver(t, ResolverOptions{Addrs: []string{s.Addr}, Retries: 2})
+
+	addrs, err := r.Resolve(context.Background(), "a.ns")
+	require.NoError(err)
+	require.Equal([]string{"10.0.0.1:80"}, addrs)
+	require.Equal(3, s.Queries("a.ns"))
+}
+
+func TestResolver_Failover(t *testing.T) {
+	require := require.New(t)
+	down, up := newTestServer(t), newTestServer(t)
+	down.Drop("a.ns", -1)
+	up.Set("a.ns", "10.0.0.1:80")
+	r := newTestResolver(t, ResolverOptions{Addrs: []string{down.Addr, up.Addr}, Retries: 1})
+	ctx := context.Background()
+
+	addrs, err := r.Resolve(ctx, "a.ns")
+	require.NoError(err)
+	require.Equal([]string{"10.0.0.1:80"}, addrs)
+
+	// sticks to the healthy agent
+	_, err = r.Resolve(ctx, "b.ns")
+	require.True(errors.Is(err, ErrNoAddr), err)
+	require.Equal(0, down.Queries("b.ns"))
+}
+
+func TestResolver_Stale(t *testing.T) {
+	require := require.New(t)
+	s := newTestServer(t)
+	s.Set("a.ns", "10.0.0.1:80")
+	r := newTestResolver(t, ResolverOptions{Addrs: []string{s.Addr}, TTL: 10 * time.Millisecond, Retries: -1})
+	ctx := context.Background()
+
+	_, err := r.Resolve(ctx, "a.ns")
+	require.NoError(err)
+
+	// stale entry is used when the agent fails
+	s.Drop("a.ns", -1)
+	time.Sleep(20 * time.Millisecond)
+	addrs, err := r.Resolve(ctx, "a.ns")
+	require.NoError(err)
+	require.Equal([]string{"10.0.0.1:80"}, addrs)
+
+	// and refreshed in background
+	s.Drop("a.ns", 0)
+	s.Set("a.ns", "10.0.0.2:80")
+	require.Eventually(func() bool {
+		addrs, _ = r.Resolve(ctx, "a.ns")
+		return len(addrs) == 1 && addrs[0] == "10.0.0.2:80"
+	}, time.Second, 5*time.Millisecond)
+}
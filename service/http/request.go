@@ -3,28 +3,248 @@ package http
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
 
 	"github.com/skyandong/util/service"
 	"github.com/skyandong/util/trace"
 )
 
-func newJSONRequest(ctx context.Context, method, url string, param interface{}) (*http.Request, error) {
-	var body io.Reader
-	if param != nil {
-		data, err := json.Marshal(param)
+// Request 定义一个HTTP请求
+type Request struct {
+	// Method 请求方法, 默认GET
+	Method string
+	// Path 服务下的路径
+	Path string
+	// Query url.Values, map[string]string 或带 `url` tag 的结构体
+	Query interface{}
+	// Header 额外的请求头
+	Header http.Header
+	// Body []byte, string, io.Reader 原样发送, url.Values 为表单, *Multipart 为文件上传, 其他按ContentType编码
+	Body interface{}
+	// ContentType 请求体的编码, 默认JSON
+	ContentType string
+}
+
+// Multipart 表单, 用于文件上传
+type Multipart struct {
+	// Fields 普通字段
+	Fields map[string]string
+	// Files 文件字段
+	Files []File
+}
+
+// File in multipart form
+type File struct {
+	// Field name
+	Field string
+	// Name of the file
+	Name string
+	// Reader of the file content
+	Reader io.Reader
+}
+
+// payload is the encoded body
+type payload struct {
+	data        []byte
+	reader      io.Reader
+	contentType string
+	encoding    string
+	rawSize     int64
+}
+
+// size of the raw and the compressed data
+func (p *payload) size() (raw, wire int64) {
+	if p == nil || p.reader != nil {
+		return
+	}
+	wire = int64(len(p.data))
+	raw = wire
+	if p.encoding != "" {
+		raw = p.rawSize
+	}
+	return
+}
+
+// replayable for retries
+func (p *payload) replayable() bool {
+	return p == nil || p.reader == nil
+}
+
+func (p *payload) body() io.Reader {
+	if p == nil {
+		return nil
+	}
+	if p.reader != nil {
+		return p.reader
+	}
+	if p.data == nil {
+		return nil
+	}
+	return bytes.NewReader(p.data)
+}
+
+func encodeBody(body interface{}, contentType string) (*payload, error) {
+	if contentType == "" {
+		contentType = MIMEJSON + "; charset=utf-8"
+	}
+	p := &payload{contentType: contentType}
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		p.data = b
+	case string:
+		p.data = []byte(b)
+	case io.Reader:
+		p.reader = b
+	case url.Values:
+		p.data = []byte(b.Encode())
+		p.contentType = MIMEForm
+	case *Multipart:
+		return encodeMultipart(b)
+	default:
+		c := GetCodec(contentType)
+		if c == nil {
+			return nil, fmt.Errorf("no codec for content type: %s", contentType)
+		}
+		data, err := c.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		p.data = data
+	}
+	return p, nil
+}
+
+func encodeMultipart(m *Multipart) (*payload, error) {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	for k, v := range m.Fields {
+		if err := w.WriteField(k, v); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range m.Files {
+		fw, err := w.CreateFormFile(f.Field, f.Name)
 		if err != nil {
 			return nil, err
 		}
-		body = bytes.NewBuffer(data)
+		if _, err = io.Copy(fw, f.Reader); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return &payload{data: buf.Bytes(), contentType: w.FormDataContentType()}, nil
+}
+
+// encodeQuery from url.Values, map or struct with `url` tags
+func encodeQuery(query interface{}) (string, error) {
+	switch q := query.(type) {
+	case nil:
+		return "", nil
+	case url.Values:
+		return q.Encode(), nil
+	case map[string]string:
+		vs := make(url.Values, len(q))
+		for k, v := range q {
+			vs.Set(k, v)
+		}
+		return vs.Encode(), nil
+	case map[string][]string:
+		return url.Values(q).Encode(), nil
+	case string:
+		return q, nil
+	}
+	rv := reflect.Indirect(reflect.ValueOf(query))
+	if rv.Kind() != reflect.Struct {
+		return "", fmt.Errorf("unsupported query type: %T", query)
+	}
+	vs := url.Values{}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name, omitempty := sf.Name, false
+		if tag := sf.Tag.Get("url"); tag != "" {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, o := range parts[1:] {
+				omitempty = omitempty || o == "omitempty"
+			}
+		}
+		fv := rv.Field(i)
+		if omitempty && isZero(fv) {
+			continue
+		}
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+			for j := 0; j < fv.Len(); j++ {
+				vs.Add(name, formatValue(fv.Index(j)))
+			}
+			continue
+		}
+		vs.Add(name, formatValue(fv))
+	}
+	return vs.Encode(), nil
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func formatValue(v reflect.Value) string {
+	v = reflect.Indirect(v)
+	switch v.Kind() {
+	case reflect.Invalid:
+		return ""
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
 	}
-	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	return fmt.Sprint(v.Interface())
+}
+
+func newRequest(ctx context.Context, method, url string, header http.Header, p *payload) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, p.body())
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	for k, vs := range header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	if p != nil {
+		req.Header.Set("Content-Type", p.contentType)
+		if p.encoding != "" {
+			req.Header.Set("Content-Encoding", p.encoding)
+		}
+	}
 	if tid := service.GetTraceID(ctx); tid != "" {
 		req.Header.Set(service.HeaderTraceID, tid)
 	}
@@ -0,0 +1,189 @@
+package http
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/skyandong/util/service"
+	"github.com/skyandong/util/service/http/namecli"
+)
+
+// Endpoint of a service
+type Endpoint struct {
+	// Scheme "http" or "https", "http" if empty
+	Scheme string
+	// Host like "ip:port" or a domain
+	Host string
+	// Prefix of the path, like "/name" for the consul sidecar
+	Prefix string
+	// Release called after the request finished if not nil
+	Release func()
+}
+
+// Resolver resolves a service name to its endpoints,
+// one of them is picked by the balance if more than one returned
+type Resolver interface {
+	Resolve(ctx context.Context, name string) ([]Endpoint, error)
+}
+
+// ResolverFunc adapts a function to Resolver
+type ResolverFunc func(ctx context.Context, name string) ([]Endpoint, error)
+
+// Resolve implements Resolver
+func (f ResolverFunc) Resolve(ctx context.Context, name string) ([]Endpoint, error) {
+	return f(ctx, name)
+}
+
+type serviceKey struct{}
+
+var (
+	resolvers    = map[string]Resolver{}
+	resolversMtx sync.RWMutex
+
+	// round robin counters by "type://name"
+	nexts sync.Map
+)
+
+func init() {
+	RegisterResolver(Consul, ResolverFunc(resolveSidecar))
+	RegisterResolver(ConsulDirect, ResolverFunc(resolveDirect))
+	RegisterResolver(NameSrv, ResolverFunc(resolveNameSrv))
+	RegisterResolver(Secure, ResolverFunc(resolveSecure))
+	RegisterResolver(Origin, ResolverFunc(resolveOrigin))
+	RegisterResolver("", ResolverFunc(resolveOrigin))
+}
+
+// RegisterResolver for the service type, replaces the existing one, should be called in init
+func RegisterResolver(typ string, r Resolver) {
+	resolversMtx.Lock()
+	resolvers[typ] = r
+	resolversMtx.Unlock()
+	service.RegisterConverter(typ, callHTTP)
+	service.RegisterClassifier(typ, classify)
+}
+
+// GetResolver of the service type, nil if not registered
+func GetResolver(typ string) Resolver {
+	resolversMtx.RLock()
+	defer resolversMtx.RUnlock()
+	return resolvers[typ]
+}
+
+// GetBalance of the service being resolved, for resolvers balancing by themselves
+func GetBalance(ctx context.Context) string {
+	s, _ := ctx.Value(serviceKey{}).(Service)
+	return s.Balance
+}
+
+// resolve the url of path, release must be called after the request finished if not nil
+func (s Service) resolve(ctx context.Context, path string) (url string, release func(), err error) {
+	r := GetResolver(s.Type)
+	if r == nil {
+		return "", nil, service.ErrServiceType
+	}
+	ctx = context.WithValue(ctx, serviceKey{}, s)
+	excluded := excludedHost(ctx)
+	var eps []Endpoint
+	for i := 0; ; i++ {
+		eps, err = r.Resolve(ctx, s.Name)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(eps) <= 0 {
+			return "", nil, ErrNoInstance
+		}
+		if excluded == "" {
+			break
+		}
+		if eps = exclude(eps, excluded); len(eps) > 0 {
+			break
+		}
+		// resolvers balancing by themselves may return another one next time
+		if i >= excludeTries-1 {
+			return "", nil, errSameEndpoint
+		}
+	}
+	ep := s.pick(eps)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	scheme := ep.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	return strings.Join([]string{scheme, "://", ep.Host, ep.Prefix, path}, ""), ep.Release, nil
+}
+
+// exclude the endpoints of host, which are released
+func exclude(eps []Endpoint, host string) []Endpoint {
+	left := eps[:0]
+	for _, ep := range eps {
+		if ep.Host != host {
+			left = append(left, ep)
+		} else if ep.Release != nil {
+			ep.Release()
+		}
+	}
+	return left
+}
+
+// pick an endpoint by the balance, the others are released
+func (s Service) pick(eps []Endpoint) Endpoint {
+	i := 0
+	if len(eps) > 1 {
+		if s.Balance == Random {
+			i = rand.Intn(len(eps))
+		} else {
+			v, _ := nexts.LoadOrStore(service.Service(s).String(), new(uint32))
+			i = int(atomic.AddUint32(v.(*uint32), 1)) % len(eps)
+		}
+	}
+	for k, ep := range eps {
+		if k != i && ep.Release != nil {
+			ep.Release()
+		}
+	}
+	return eps[i]
+}
+
+// resolveSidecar to the consul sidecar on the node
+func resolveSidecar(ctx context.Context, name string) ([]Endpoint, error) {
+	return []Endpoint{{Host: localIP + ":9090", Prefix: "/" + name}}, nil
+}
+
+// resolveDirect by in-process discovery, falls back to the sidecar if the agent is unreachable
+func resolveDirect(ctx context.Context, name string) ([]Endpoint, error) {
+	s, _ := ctx.Value(serviceKey{}).(Service)
+	addr, release, err := getDiscovery(name, s.Discovery).pick(ctx, s.Balance)
+	if err == nil {
+		return []Endpoint{{Host: addr, Release: release}}, nil
+	}
+	if err != errUnreachable {
+		return nil, err
+	}
+	return resolveSidecar(ctx, name)
+}
+
+// resolveNameSrv to all addrs, balanced by the service
+func resolveNameSrv(ctx context.Context, name string) ([]Endpoint, error) {
+	addrs, err := namecli.DefaultResolver().Resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	eps := make([]Endpoint, len(addrs))
+	for i, addr := range addrs {
+		eps[i] = Endpoint{Host: addr}
+	}
+	return eps, nil
+}
+
+func resolveSecure(ctx context.Context, name string) ([]Endpoint, error) {
+	return []Endpoint{{Scheme: "https", Host: name}}, nil
+}
+
+func resolveOrigin(ctx context.Context, name string) ([]Endpoint, error) {
+	return []Endpoint{{Host: name}}, nil
+}
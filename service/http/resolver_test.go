@@ -0,0 +1,45 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skyandong/util/service/http/namecli"
+	"github.com/skyandong/util/service/http/namecli/namesrvtest"
+)
+
+func TestService_NameSrvBalance(t *testing.T) {
+	require := require.New(t)
+	var hosts []string
+	for i := 0; i < 2; i++ {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.Host))
+		}))
+		defer ts.Close()
+		hosts = append(hosts, strings.TrimPrefix(ts.URL, "http://"))
+	}
+	ns, err := namesrvtest.NewServer()
+	require.NoError(err)
+	defer ns.Close()
+	ns.Set("echo.ns", hosts...)
+	r := namecli.NewResolver(ns.Addr, time.Minute)
+	defer r.Close()
+	defer namecli.SetDefaultResolver(namecli.SetDefaultResolver(r))
+
+	for _, balance := range []string{RoundRobin, Random} {
+		s := Service{Type: NameSrv, Name: "echo.ns", Balance: balance}
+		got := map[string]bool{}
+		for i := 0; i < 20; i++ {
+			data, err := s.GetJSON(context.Background(), "/")
+			require.NoError(err)
+			got[string(data)] = true
+		}
+		require.Equal(map[string]bool{hosts[0]: true, hosts[1]: true}, got, balance)
+	}
+}
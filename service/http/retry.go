@@ -0,0 +1,101 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/skyandong/util/service"
+)
+
+const (
+	defaultBaseDelay = 50 * time.Millisecond
+	defaultMaxDelay  = time.Second
+)
+
+// retrier decides whether and when to retry
+type retrier struct {
+	conf   *service.RetryConf
+	method string
+}
+
+func newRetrier(conf *service.RetryConf, method string) *retrier {
+	if conf == nil || conf.MaxAttempts <= 1 {
+		return nil
+	}
+	return &retrier{conf: conf, method: method}
+}
+
+// backoff returns the delay before the next attempt, false if no more attempt
+func (r *retrier) backoff(ctx context.Context, attempt int, err error) (time.Duration, bool) {
+	if r == nil || attempt >= r.conf.MaxAttempts || !r.retryable(ctx, err) {
+		return 0, false
+	}
+	base, max := r.conf.BaseDelay, r.conf.MaxDelay
+	if base <= 0 {
+		base = defaultBaseDelay
+	}
+	if max <= 0 {
+		max = defaultMaxDelay
+	}
+	delay := base << uint(attempt-1)
+	if delay > max || delay <= 0 {
+		delay = max
+	}
+	if j := r.conf.Jitter; j > 0 {
+		if j > 1 {
+			j = 1
+		}
+		delay -= time.Duration(float64(delay) * j * rand.Float64())
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		if ra := se.RetryAfter(); ra > delay {
+			delay = ra
+		}
+	}
+	// no time left for another attempt
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+		return 0, false
+	}
+	return delay, true
+}
+
+func (r *retrier) retryable(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	// rejected by the instance breaker without sending, try another instance
+	if err == service.ErrCircuitOpen {
+		return true
+	}
+	switch r.method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		if !r.conf.NonIdempotent {
+			return false
+		}
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= http.StatusInternalServerError || se.StatusCode == http.StatusTooManyRequests
+	}
+	// transport errors
+	var ue *url.Error
+	return errors.As(err, &ue)
+}
+
+// wait for the delay or ctx done
+func wait(ctx context.Context, delay time.Duration) error {
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,145 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skyandong/util/service"
+)
+
+// failing responds the status for the first n calls, then 200
+func failing(n int32, status int, header http.Header) (http.HandlerFunc, *int32) {
+	var calls int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= n {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}, &calls
+}
+
+func TestService_Retry(t *testing.T) {
+	require := require.New(t)
+	h, calls := failing(2, http.StatusServiceUnavailable, nil)
+	s := newTestService(t, h)
+	var lock sync.Mutex
+	var attempts []int
+	var errs []error
+	s.Trace = func(ctx context.Context, svc service.Service, path string, req, reply interface{}, elapse time.Duration, err error) {
+		lock.Lock()
+		attempts = append(attempts, service.GetAttempt(ctx))
+		errs = append(errs, err)
+		lock.Unlock()
+	}
+	s.Retry = &service.RetryConf{MaxAttempts: 3, BaseDelay: 20 * time.Millisecond}
+
+	ts := time.Now()
+	data, err := s.GetJSON(context.Background(), "/retry")
+	require.NoError(err)
+	require.Equal("ok", string(data))
+	require.Equal(int32(3), atomic.LoadInt32(calls))
+	// 20ms then 40ms
+	require.True(time.Since(ts) >= 60*time.Millisecond)
+	require.Equal([]int{1, 2, 3}, attempts)
+	require.Error(errs[0])
+	require.Error(errs[1])
+	require.NoError(errs[2])
+
+	// gives up after max attempts
+	h, calls = failing(5, http.StatusBadGateway, nil)
+	s = newTestService(t, h)
+	s.Retry = &service.RetryConf{MaxAttempts: 2, BaseDelay: time.Millisecond}
+	_, err = s.GetJSON(context.Background(), "/retry")
+	se, ok := err.(*StatusError)
+	require.True(ok, err)
+	require.Equal(http.StatusBadGateway, se.StatusCode)
+	require.Equal(int32(2), atomic.LoadInt32(calls))
+
+	// 4xx is not retried
+	h, calls = failing(1, http.StatusNotFound, nil)
+	s = newTestService(t, h)
+	s.Retry = &service.RetryConf{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	_, err = s.GetJSON(context.Background(), "/retry")
+	require.Error(err)
+	require.Equal(int32(1), atomic.LoadInt32(calls))
+}
+
+func TestService_RetryNonIdempotent(t *testing.T) {
+	require := require.New(t)
+	h, calls := failing(1, http.StatusServiceUnavailable, nil)
+	s := newTestService(t, h)
+	s.Retry = &service.RetryConf{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	_, err := s.PostJSON(context.Background(), "/post", map[string]int{"n": 1})
+	require.Error(err)
+	require.Equal(int32(1), atomic.LoadInt32(calls))
+
+	h, calls = failing(1, http.StatusServiceUnavailable, nil)
+	s = newTestService(t, h)
+	s.Retry = &service.RetryConf{MaxAttempts: 3, BaseDelay: time.Millisecond, NonIdempotent: true}
+	data, err := s.PostJSON(context.Background(), "/post", map[string]int{"n": 1})
+	require.NoError(err)
+	require.Equal("ok", string(data))
+	require.Equal(int32(2), atomic.LoadInt32(calls))
+}
+
+func TestService_RetryAfter(t *testing.T) {
+	require := require.New(t)
+	h, calls := failing(1, http.StatusTooManyRequests, http.Header{"Retry-After": {"1"}})
+	s := newTestService(t, h)
+	s.Retry = &service.RetryConf{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+	ts := time.Now()
+	_, err := s.GetJSON(context.Background(), "/retry-after")
+	require.NoError(err)
+	require.Equal(int32(2), atomic.LoadInt32(calls))
+	require.True(time.Since(ts) >= time.Second)
+}
+
+func TestService_RetryDeadline(t *testing.T) {
+	require := require.New(t)
+	h, calls := failing(1, http.StatusServiceUnavailable, nil)
+	s := newTestService(t, h)
+	s.Retry = &service.RetryConf{MaxAttempts: 3, BaseDelay: 200 * time.Millisecond}
+
+	// no time left for the backoff
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	ts := time.Now()
+	_, err := s.GetJSON(ctx, "/retry")
+	require.Error(err)
+	require.Equal(int32(1), atomic.LoadInt32(calls))
+	require.True(time.Since(ts) < 100*time.Millisecond)
+}
+
+func TestRetrier_Backoff(t *testing.T) {
+	assert := assert.New(t)
+	err := &StatusError{StatusCode: http.StatusServiceUnavailable}
+	ctx := context.Background()
+	r := newRetrier(&service.RetryConf{MaxAttempts: 10, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}, http.MethodGet)
+
+	for attempt, expected := range []time.Duration{10, 20, 40, 50, 50} {
+		d, ok := r.backoff(ctx, attempt+1, err)
+		assert.True(ok)
+		assert.Equal(expected*time.Millisecond, d)
+	}
+	_, ok := r.backoff(ctx, 10, err)
+	assert.False(ok)
+
+	r.conf.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d, _ := r.backoff(ctx, 1, err)
+		assert.True(d > 5*time.Millisecond && d <= 10*time.Millisecond, d)
+	}
+	assert.Nil(newRetrier(&service.RetryConf{MaxAttempts: 1}, http.MethodGet))
+}
@@ -4,19 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/skyandong/util/service"
-	"github.com/skyandong/util/service/http/namecli"
 )
 
 const (
 	// Consul 基于consul
 	Consul = "consul"
+	// ConsulDirect 基于consul, 进程内服务发现, agent不可达时退化为Consul
+	ConsulDirect = "consul-direct"
 	// NameSrv 基于namesrv
 	NameSrv = "namesrv"
 	// Origin 或 "" 为原始域名或IP
@@ -37,102 +40,346 @@ func init() {
 	if k8sNodeIP != "" {
 		localIP = k8sNodeIP
 	}
-	service.RegisterConverter(Consul, callHTTP)
-	service.RegisterConverter(NameSrv, callHTTP)
-	service.RegisterConverter(Origin, callHTTP)
-	service.RegisterConverter(Secure, callHTTP)
-	service.RegisterConverter("", callHTTP)
 }
 
 func callHTTP(ctx context.Context, svc service.Service, path string, req, reply interface{}) (err error) {
-	data, err := Service(svc).PostJSON(ctx, path, req)
-	if err != nil {
+	// already intercepted by service.Call
+	r := &Request{Method: http.MethodPost, Path: path, Body: req}
+	rsp, err := Service(svc).exchange(ctx, r, false)
+	if err != nil || len(rsp.data) <= 0 {
 		return
 	}
-	return json.Unmarshal(data, reply)
+	return json.Unmarshal(rsp.data, reply)
 }
 
 // Call 调用服务并解析结果到指定类型
 func (s Service) Call(ctx context.Context, path string, req, reply interface{}) (err error) {
-	data, err := s.PostJSON(ctx, path, req)
-	if err != nil {
-		return
-	}
-	return json.Unmarshal(data, reply)
+	return service.Service(s).Invoke(ctx, path, req, reply, callHTTP)
 }
 
 // URL 返回path对应的url
 func (s Service) URL(ctx context.Context, path string) (string, error) {
-	schema := "http://"
-	if s.Type == Secure {
-		schema = "https://"
-	}
-	if !strings.HasPrefix(path, "/") {
-		path = "/" + path
-	}
-	switch s.Type {
-	case Consul:
-		return strings.Join([]string{schema, localIP + ":9090/", s.Name, path}, ""), nil
-	case NameSrv:
-		addr, err := namecli.Name(ctx, s.Name)
-		if err != nil {
-			return "", err
-		}
-		return strings.Join([]string{schema, addr, path}, ""), nil
-	case Secure, Origin, "":
-		return strings.Join([]string{schema, s.Name, path}, ""), nil
+	url, release, err := s.resolve(ctx, path)
+	if release != nil {
+		release()
 	}
-	return "", service.ErrServiceType
+	return url, err
 }
 
 // GetJSON 请求对应的服务并返回原始结果数据
 func (s Service) GetJSON(ctx context.Context, path string) (data []byte, err error) {
-	ts := time.Now()
-	data, err = s.requestJSON(ctx, http.MethodGet, path, nil)
-	svc := service.Service(s)
-	// be compatible with json.RawMessage
-	if len(data) <= 0 {
-		data = nil
-	}
-	svc.DoTrace(ctx, svc, path, nil, json.RawMessage(data), time.Now().Sub(ts), err)
-	return
+	return s.Do(ctx, &Request{Method: http.MethodGet, Path: path})
 }
 
 // PostJSON 请求对应的服务并返回原始结果数据
 func (s Service) PostJSON(ctx context.Context, path string, param interface{}) (data []byte, err error) {
+	return s.Do(ctx, &Request{Method: http.MethodPost, Path: path, Body: param})
+}
+
+// PutJSON 请求对应的服务并返回原始结果数据
+func (s Service) PutJSON(ctx context.Context, path string, param interface{}) (data []byte, err error) {
+	return s.Do(ctx, &Request{Method: http.MethodPut, Path: path, Body: param})
+}
+
+// PatchJSON 请求对应的服务并返回原始结果数据
+func (s Service) PatchJSON(ctx context.Context, path string, param interface{}) (data []byte, err error) {
+	return s.Do(ctx, &Request{Method: http.MethodPatch, Path: path, Body: param})
+}
+
+// DeleteJSON 请求对应的服务并返回原始结果数据
+func (s Service) DeleteJSON(ctx context.Context, path string) (data []byte, err error) {
+	return s.Do(ctx, &Request{Method: http.MethodDelete, Path: path})
+}
+
+// Do 请求对应的服务并返回原始结果数据,
+// 拦截器收到的 req 为 *Request, reply 为 *[]byte
+func (s Service) Do(ctx context.Context, r *Request) (data []byte, err error) {
+	err = service.Service(s).Invoke(ctx, r.Path, r, &data, callData)
+	return
+}
+
+// DoInto 请求对应的服务并按响应的Content-Type解析结果到reply,
+// 拦截器收到的 req 为 *Request
+func (s Service) DoInto(ctx context.Context, r *Request, reply interface{}) error {
+	return service.Service(s).Invoke(ctx, r.Path, r, reply, callInto)
+}
+
+// Stream 请求对应的服务并返回响应体, 用于大文件下载, 调用方负责关闭,
+// 拦截器收到的 req 为 *Request, reply 为 *io.ReadCloser
+func (s Service) Stream(ctx context.Context, r *Request) (body io.ReadCloser, err error) {
+	err = service.Service(s).Invoke(ctx, r.Path, r, &body, callStream)
+	return
+}
+
+func callData(ctx context.Context, svc service.Service, path string, req, reply interface{}) error {
+	r, err := requestOf(req, path)
+	if err != nil {
+		return err
+	}
+	data, ok := reply.(*[]byte)
+	if !ok {
+		return fmt.Errorf("unexpected reply type: %T", reply)
+	}
+	rsp, err := Service(svc).exchange(ctx, r, false)
+	if err != nil {
+		return err
+	}
+	*data = rsp.data
+	return nil
+}
+
+func callInto(ctx context.Context, svc service.Service, path string, req, reply interface{}) error {
+	r, err := requestOf(req, path)
+	if err != nil {
+		return err
+	}
+	rsp, err := Service(svc).exchange(ctx, r, false)
+	if err != nil || len(rsp.data) <= 0 {
+		return err
+	}
+	c := GetCodec(rsp.header.Get("Content-Type"))
+	if c == nil {
+		c = GetCodec(r.ContentType)
+	}
+	if c == nil {
+		c = jsonCodec{}
+	}
+	return c.Unmarshal(rsp.data, reply)
+}
+
+func callStream(ctx context.Context, svc service.Service, path string, req, reply interface{}) error {
+	r, err := requestOf(req, path)
+	if err != nil {
+		return err
+	}
+	body, ok := reply.(*io.ReadCloser)
+	if !ok {
+		return fmt.Errorf("unexpected reply type: %T", reply)
+	}
+	rsp, err := Service(svc).exchange(ctx, r, true)
+	if err != nil {
+		return err
+	}
+	*body = rsp.body
+	return nil
+}
+
+// requestOf req with the path which may be changed by interceptors
+func requestOf(req interface{}, path string) (*Request, error) {
+	r, ok := req.(*Request)
+	if !ok {
+		return nil, fmt.Errorf("unexpected request type: %T", req)
+	}
+	if r.Path != path {
+		c := *r
+		c.Path = path
+		r = &c
+	}
+	return r, nil
+}
+
+// response of an attempt
+type response struct {
+	status   int
+	data     []byte
+	header   http.Header
+	body     io.ReadCloser
+	rawSize  int64
+	wireSize int64
+}
+
+// releaseBody releases the instance on close
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releaseBody) Close() error {
+	b.once.Do(b.release)
+	return b.ReadCloser.Close()
+}
+
+// exchange requests the service
+func (s Service) exchange(ctx context.Context, r *Request, stream bool) (rsp *response, err error) {
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	path := r.Path
+	query, err := encodeQuery(r.Query)
+	if err != nil {
+		return
+	}
+	if query != "" {
+		if strings.Contains(path, "?") {
+			path += "&" + query
+		} else {
+			path += "?" + query
+		}
+	}
+	p, err := encodeBody(r.Body, r.ContentType)
+	if err != nil {
+		return
+	}
+	if err = compress(p, s.Compress); err != nil {
+		return
+	}
+
+	c := &call{
+		method: method,
+		path:   path,
+		req:    r,
+		p:      p,
+		stream: stream,
+	}
+	if s.Cache != nil && method == http.MethodGet && !stream {
+		return s.cached(ctx, c)
+	}
+	return s.retried(ctx, c)
+}
+
+// retried requests with retries, each attempt is traced
+func (s Service) retried(ctx context.Context, c *call) (rsp *response, err error) {
+	rt := newRetrier(s.Retry, c.method)
+	if !c.p.replayable() {
+		rt = nil
+	}
+	hg := newHedger(s, c)
+	for attempt := 1; ; attempt++ {
+		actx := ctx
+		if rt != nil {
+			actx = service.WithAttempt(ctx, attempt)
+		}
+		if hg != nil {
+			rsp, err = hg.do(actx)
+		} else {
+			rsp, err = s.traced(actx, c)
+		}
+
+		delay, ok := rt.backoff(ctx, attempt, err)
+		if !ok || wait(ctx, delay) != nil {
+			return
+		}
+	}
+}
+
+// call shared by attempts
+type call struct {
+	method string
+	path   string
+	req    *Request
+	p      *payload
+	stream bool
+}
+
+// traced attempt
+func (s Service) traced(ctx context.Context, c *call) (rsp *response, err error) {
 	ts := time.Now()
-	data, err = s.requestJSON(ctx, http.MethodPost, path, param)
-	svc := service.Service(s)
-	// be compatible with json.RawMessage
-	if len(data) <= 0 {
-		data = nil
+	rsp, err = s.attempt(ctx, c.method, c.path, c.req.Header, c.p, c.stream)
+	size := &service.BodySize{}
+	size.RequestRaw, size.RequestWire = c.p.size()
+	if rsp != nil {
+		size.ResponseRaw, size.ResponseWire = rsp.rawSize, rsp.wireSize
+	}
+	// the hedged request is not sent
+	if err == errSameEndpoint {
+		return
 	}
-	svc.DoTrace(ctx, svc, path, param, json.RawMessage(data), time.Now().Sub(ts), err)
+	svc := service.Service(s)
+	svc.DoTrace(service.WithBodySize(ctx, size), svc, c.path, c.req.Body, traceReply(rsp), time.Now().Sub(ts), err)
 	return
 }
 
-func (s Service) requestJSON(ctx context.Context, method, path string, param interface{}) (data []byte, err error) {
-	url, err := s.URL(ctx, path)
+func (s Service) attempt(ctx context.Context, method, path string, header http.Header, p *payload, stream bool) (rsp *response, err error) {
+	url, release, err := s.resolve(ctx, path)
 	if err != nil {
 		return nil, err
 	}
-	req, err := newJSONRequest(ctx, method, url, param)
+	if release == nil {
+		release = func() {}
+	}
+	req, err := newRequest(ctx, method, url, header, p)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	recordHost(ctx, req.URL.Host)
+	// decompressed by do instead of the transport
+	if s.Compress != nil && req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	err = service.Service(s).ProtectInstance(req.URL.Host, func() (e error) {
+		rsp, e = s.do(req, stream)
+		return
+	})
+	if stream && err == nil {
+		rsp.body = &releaseBody{ReadCloser: rsp.body, release: release}
+	} else {
+		release()
+	}
+	return
+}
+
+func (s Service) do(req *http.Request, stream bool) (rsp *response, err error) {
+	c, err := DefaultClientCache.Client(s)
 	if err != nil {
 		return nil, err
 	}
-	c := DefaultClientCache.Get(s)
 	r, err := c.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	// not modified is expected by the conditional request
+	notModified := r.StatusCode == http.StatusNotModified && req.Header.Get("If-None-Match") != ""
+	if !notModified && !accepted(s.StatusCodes, r.StatusCode) {
+		body, _ := ioutil.ReadAll(io.LimitReader(r.Body, maxErrorBody))
+		_ = r.Body.Close()
+		err = &StatusError{
+			StatusCode: r.StatusCode,
+			Header:     r.Header,
+			Body:       body,
+			URL:        req.URL.String(),
+		}
+		return
+	}
+	rsp = &response{status: r.StatusCode, header: r.Header}
+	encoding := ""
+	if !r.Uncompressed {
+		encoding = r.Header.Get("Content-Encoding")
+		r.Header.Del("Content-Encoding")
+	}
+	if stream {
+		rsp.body, err = decompressReader(r.Body, encoding)
+		if err != nil {
+			_ = r.Body.Close()
+			return nil, err
+		}
+		return
+	}
 	defer func() {
 		if e := r.Body.Close(); err == nil {
 			err = e
 		}
 	}()
-	if r.StatusCode != http.StatusOK {
-		err = fmt.Errorf("status code: %d", r.StatusCode)
-		return
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	rsp.wireSize = int64(len(data))
+	rsp.data, err = decompress(data, encoding)
+	rsp.rawSize = int64(len(rsp.data))
+	return
+}
+
+// traceReply for the caller trace
+func traceReply(rsp *response) interface{} {
+	// be compatible with json.RawMessage
+	if rsp == nil || len(rsp.data) <= 0 {
+		return json.RawMessage(nil)
+	}
+	if ct := rsp.header.Get("Content-Type"); ct != "" && mediaType(ct) != MIMEJSON {
+		return rsp.data
 	}
-	return ioutil.ReadAll(r.Body)
+	return json.RawMessage(rsp.data)
 }
@@ -0,0 +1,215 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skyandong/util/service"
+	"github.com/skyandong/util/service/http/namecli"
+	"github.com/skyandong/util/service/http/namecli/namesrvtest"
+)
+
+func newTestService(t *testing.T, h http.HandlerFunc) Service {
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	return Service{Type: Origin, Name: strings.TrimPrefix(ts.URL, "http://")}
+}
+
+func TestService_Do(t *testing.T) {
+	require := require.New(t)
+	s := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", MIMEJSON)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"method": r.Method,
+			"query":  r.URL.RawQuery,
+			"type":   r.Header.Get("Content-Type"),
+			"body":   string(body),
+		})
+	})
+	ctx := context.Background()
+
+	var reply map[string]string
+	err := s.DoInto(ctx, &Request{
+		Method: http.MethodPut,
+		Path:   "/put",
+		Query: struct {
+			ID   int      `url:"id"`
+			Tags []string `url:"tag"`
+			Skip string   `url:"skip,omitempty"`
+		}{ID: 1, Tags: []string{"a", "b"}},
+		Body: map[string]int{"n": 1},
+	}, &reply)
+	require.NoError(err)
+	require.Equal(http.MethodPut, reply["method"])
+	require.Equal("id=1&tag=a&tag=b", reply["query"])
+	require.Equal(`{"n":1}`, reply["body"])
+
+	data, err := s.Do(ctx, &Request{Method: http.MethodPost, Body: map[string][]string{"k": {"v"}}})
+	require.NoError(err)
+	require.NoError(json.Unmarshal(data, &reply))
+	require.Equal(`{"k":["v"]}`, reply["body"])
+
+	body, err := s.Stream(ctx, &Request{Path: "/stream", Query: map[string]string{"a": "1"}})
+	require.NoError(err)
+	data, err = ioutil.ReadAll(body)
+	require.NoError(err)
+	require.NoError(body.Close())
+	require.Contains(string(data), `"query":"a=1"`)
+}
+
+func TestService_StatusError(t *testing.T) {
+	assert := assert.New(t)
+	var calls int
+	s := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("unavailable"))
+	})
+
+	_, err := s.GetJSON(context.Background(), "/error")
+	se, ok := err.(*StatusError)
+	assert.True(ok)
+	assert.Equal(http.StatusServiceUnavailable, se.StatusCode)
+	assert.Equal("unavailable", string(se.Body))
+	assert.Equal(1, calls)
+}
+
+func TestService_Cache(t *testing.T) {
+	require := require.New(t)
+	var calls, revalidated int
+	s := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/conf" {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidated++
+			w.Header().Set("Cache-Control", "max-age=0")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = w.Write([]byte(`{"v":1}`))
+	})
+	s.Cache = &service.CacheConf{MaxStale: time.Minute}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		data, err := s.GetJSON(ctx, "/conf")
+		require.NoError(err)
+		require.Equal(`{"v":1}`, string(data))
+	}
+	require.Equal(3, calls)
+	require.Equal(2, revalidated)
+
+	// fresh entries are served without requests
+	s.Cache.TTL = time.Minute
+	_, err := s.GetJSON(ctx, "/fresh")
+	require.NoError(err)
+	_, err = s.GetJSON(ctx, "/fresh")
+	require.NoError(err)
+	require.Equal(4, calls)
+}
+
+func TestService_Compress(t *testing.T) {
+	require := require.New(t)
+	s := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		raw, err := decompress(body, r.Header.Get("Content-Encoding"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		p := &payload{data: raw}
+		_ = compress(p, &service.CompressConf{Encoding: Zstd})
+		w.Header().Set("Content-Encoding", p.encoding)
+		_, _ = w.Write(p.data)
+	})
+	var size *service.BodySize
+	s.Trace = func(ctx context.Context, svc service.Service, path string, req, reply interface{}, elapse time.Duration, err error) {
+		size = service.GetBodySize(ctx)
+	}
+	s.Compress = &service.CompressConf{MinSize: 16}
+
+	param := map[string]string{"data": strings.Repeat("x", 1024)}
+	data, err := s.PostJSON(context.Background(), "/echo", param)
+	require.NoError(err)
+	expected, _ := json.Marshal(param)
+	require.Equal(expected, data)
+	require.Equal(int64(len(expected)), size.RequestRaw)
+	require.True(size.RequestWire < size.RequestRaw)
+	require.Equal(int64(len(expected)), size.ResponseRaw)
+	require.True(size.ResponseWire < size.ResponseRaw)
+}
+
+func TestService_NameSrv(t *testing.T) {
+	require := require.New(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer ts.Close()
+	ns, err := namesrvtest.NewServer()
+	require.NoError(err)
+	defer ns.Close()
+	ns.Set("echo.ns", strings.TrimPrefix(ts.URL, "http://"))
+	r := namecli.NewResolver(ns.Addr, time.Minute)
+	defer r.Close()
+	defer namecli.SetDefaultResolver(namecli.SetDefaultResolver(r))
+
+	s := Service{Type: NameSrv, Name: "echo.ns"}
+	data, err := s.GetJSON(context.Background(), "/hello")
+	require.NoError(err)
+	require.Equal("/hello", string(data))
+
+	s.Name = "none.ns"
+	_, err = s.GetJSON(context.Background(), "/hello")
+	require.True(errors.Is(err, namecli.ErrNoAddr), err)
+}
+
+func TestService_Resolver(t *testing.T) {
+	require := require.New(t)
+	var hosts []string
+	for i := 0; i < 2; i++ {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.Host + r.URL.Path))
+		}))
+		defer ts.Close()
+		hosts = append(hosts, strings.TrimPrefix(ts.URL, "http://"))
+	}
+	var released int
+	RegisterResolver("static", ResolverFunc(func(ctx context.Context, name string) ([]Endpoint, error) {
+		require.Equal(Random, GetBalance(ctx))
+		var eps []Endpoint
+		for _, h := range hosts {
+			eps = append(eps, Endpoint{Host: h, Prefix: "/" + name, Release: func() { released++ }})
+		}
+		return eps, nil
+	}))
+
+	s := Service{Type: "static", Name: "echo", Balance: Random}
+	got := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		data, err := s.GetJSON(context.Background(), "/hello")
+		require.NoError(err)
+		got[string(data)] = true
+	}
+	require.Equal(map[string]bool{hosts[0] + "/echo/hello": true, hosts[1] + "/echo/hello": true}, got)
+	require.Equal(40, released)
+
+	s.Type = "unknown"
+	_, err := s.URL(context.Background(), "/hello")
+	require.Equal(service.ErrServiceType, err)
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// Interceptor wraps an outbound call, next must be called to continue the chain
+type Interceptor func(ctx context.Context, svc Service, path string, req, reply interface{}, next CallFunc) error
+
+var (
+	interceptors    []Interceptor
+	interceptorsMtx sync.RWMutex
+)
+
+// Use adds global interceptors, which run before the interceptors of a service
+func Use(is ...Interceptor) {
+	interceptorsMtx.Lock()
+	defer interceptorsMtx.Unlock()
+	interceptors = append(interceptors, is...)
+}
+
+// Invoke fn through the interceptors, the limiter and the circuit breaker of the service
+func (s Service) Invoke(ctx context.Context, path string, req, reply interface{}, fn CallFunc) error {
+	interceptorsMtx.RLock()
+	is := make([]Interceptor, 0, len(interceptors)+len(s.Interceptors))
+	is = append(is, interceptors...)
+	interceptorsMtx.RUnlock()
+	is = append(is, s.Interceptors...)
+
+	call := func(ctx context.Context, svc Service, path string, req, reply interface{}) error {
+		return svc.Throttle(ctx, func() error {
+			return svc.Protect(func() error {
+				return fn(ctx, svc, path, req, reply)
+			})
+		})
+	}
+	for i := len(is) - 1; i >= 0; i-- {
+		interceptor, next := is[i], call
+		call = func(ctx context.Context, svc Service, path string, req, reply interface{}) error {
+			return interceptor(ctx, svc, path, req, reply, next)
+		}
+	}
+	return call(ctx, s, path, req, reply)
+}
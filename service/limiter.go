@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited means the request is rejected by the limiter
+var ErrRateLimited = errors.New("rate limited")
+
+// Limiter with a token bucket and a max inflight semaphore
+type Limiter struct {
+	conf   LimitConf
+	lock   sync.Mutex
+	burst  float64
+	tokens float64
+	last   time.Time
+	sem    chan struct{}
+}
+
+var (
+	limiters    = map[string]*Limiter{}
+	limitersMtx sync.Mutex
+)
+
+// NewLimiter with the conf
+func NewLimiter(conf LimitConf) *Limiter {
+	l := &Limiter{
+		conf: conf,
+		last: time.Now(),
+	}
+	if conf.QPS > 0 {
+		l.burst = float64(conf.Burst)
+		if l.burst <= 0 {
+			l.burst = conf.QPS
+		}
+		if l.burst < 1 {
+			l.burst = 1
+		}
+		l.tokens = l.burst
+	}
+	if conf.MaxInflight > 0 {
+		l.sem = make(chan struct{}, conf.MaxInflight)
+	}
+	return l
+}
+
+// GetLimiter returns the shared limiter of name, creates it if not exist
+func GetLimiter(name string, conf LimitConf) *Limiter {
+	limitersMtx.Lock()
+	defer limitersMtx.Unlock()
+	l, ok := limiters[name]
+	if !ok {
+		l = NewLimiter(conf)
+		limiters[name] = l
+	}
+	return l
+}
+
+// Acquire a token and an inflight slot, release must be called after the request finished if no error
+func (l *Limiter) Acquire(ctx context.Context) (release func(), err error) {
+	if err = l.take(ctx); err != nil {
+		return nil, err
+	}
+	if l.sem == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.sem <- struct{}{}:
+	default:
+		if !l.conf.Wait {
+			return nil, ErrRateLimited
+		}
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-l.sem
+		})
+	}, nil
+}
+
+// Do fn if acquired
+func (l *Limiter) Do(ctx context.Context, fn func() error) error {
+	release, err := l.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn()
+}
+
+// take a token from the bucket, waiting if allowed
+func (l *Limiter) take(ctx context.Context) error {
+	if l.conf.QPS <= 0 {
+		return nil
+	}
+	l.lock.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.conf.QPS
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		l.lock.Unlock()
+		return nil
+	}
+	wait := time.Duration((1 - l.tokens) / l.conf.QPS * float64(time.Second))
+	if !l.conf.Wait {
+		l.lock.Unlock()
+		return ErrRateLimited
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(wait).After(deadline) {
+		l.lock.Unlock()
+		return ErrRateLimited
+	}
+	// reserve the token
+	l.tokens--
+	l.lock.Unlock()
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		// give the reservation back
+		l.lock.Lock()
+		l.tokens++
+		l.lock.Unlock()
+		return ctx.Err()
+	}
+}
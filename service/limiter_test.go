@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	// fail fast when the bucket is empty
+	l := NewLimiter(LimitConf{QPS: 10, Burst: 2})
+	require.NoError(l.Do(ctx, func() error { return nil }))
+	require.NoError(l.Do(ctx, func() error { return nil }))
+	require.Equal(ErrRateLimited, l.Do(ctx, func() error { return nil }))
+
+	// wait for a token, but not beyond the deadline
+	l = NewLimiter(LimitConf{QPS: 10, Burst: 1, Wait: true})
+	require.NoError(l.Do(ctx, func() error { return nil }))
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	require.Equal(ErrRateLimited, l.Do(tctx, func() error { return nil }))
+	ts := time.Now()
+	require.NoError(l.Do(ctx, func() error { return nil }))
+	require.True(time.Since(ts) >= 50*time.Millisecond)
+
+	// max inflight
+	l = NewLimiter(LimitConf{MaxInflight: 1})
+	release, err := l.Acquire(ctx)
+	require.NoError(err)
+	_, err = l.Acquire(ctx)
+	require.Equal(ErrRateLimited, err)
+	release()
+	release, err = l.Acquire(ctx)
+	require.NoError(err)
+	release()
+}
@@ -0,0 +1,133 @@
+package service
+
+import "time"
+
+// RetryConf 重试策略
+type RetryConf struct {
+	// MaxAttempts 最大尝试次数, 包括第一次, <= 1 不重试
+	MaxAttempts int `json:"maxAttempts" yaml:"maxAttempts"`
+	// BaseDelay 指数退避的初始间隔
+	BaseDelay time.Duration `json:"baseDelay" yaml:"baseDelay"`
+	// MaxDelay 退避间隔上限
+	MaxDelay time.Duration `json:"maxDelay" yaml:"maxDelay"`
+	// Jitter 随机抖动比例, [0, 1]
+	Jitter float64 `json:"jitter" yaml:"jitter"`
+	// NonIdempotent 允许重试POST等非幂等请求
+	NonIdempotent bool `json:"nonIdempotent" yaml:"nonIdempotent"`
+}
+
+// BreakerConf 熔断策略
+type BreakerConf struct {
+	// Window 统计周期, 关闭状态下每个周期重置计数
+	Window time.Duration `json:"window" yaml:"window"`
+	// MinRequests 周期内触发熔断的最少请求数
+	MinRequests int `json:"minRequests" yaml:"minRequests"`
+	// ErrorRate 错误率阈值, (0, 1]
+	ErrorRate float64 `json:"errorRate" yaml:"errorRate"`
+	// SlowCall 慢调用耗时阈值, 0 不统计慢调用
+	SlowCall time.Duration `json:"slowCall" yaml:"slowCall"`
+	// SlowRate 慢调用比例阈值, (0, 1]
+	SlowRate float64 `json:"slowRate" yaml:"slowRate"`
+	// OpenTimeout 打开状态持续时间, 之后进入半开状态
+	OpenTimeout time.Duration `json:"openTimeout" yaml:"openTimeout"`
+	// HalfOpenRequests 半开状态允许的探测请求数, 全部成功后关闭
+	HalfOpenRequests int `json:"halfOpenRequests" yaml:"halfOpenRequests"`
+	// PerInstance 按实例熔断, 仅对可解析出实例地址的类型有效
+	PerInstance bool `json:"perInstance" yaml:"perInstance"`
+}
+
+// TransportConf HTTP连接配置, 0 值使用默认配置
+type TransportConf struct {
+	// Timeout 整个请求的超时, 包括读取响应体
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+	// DialTimeout 建立连接超时
+	DialTimeout time.Duration `json:"dialTimeout" yaml:"dialTimeout"`
+	// KeepAlive TCP keepalive 间隔, 负数关闭
+	KeepAlive time.Duration `json:"keepAlive" yaml:"keepAlive"`
+	// TLSHandshakeTimeout TLS握手超时
+	TLSHandshakeTimeout time.Duration `json:"tlsHandshakeTimeout" yaml:"tlsHandshakeTimeout"`
+	// ResponseHeaderTimeout 等待响应头超时
+	ResponseHeaderTimeout time.Duration `json:"responseHeaderTimeout" yaml:"responseHeaderTimeout"`
+	// IdleConnTimeout 空闲连接超时
+	IdleConnTimeout time.Duration `json:"idleConnTimeout" yaml:"idleConnTimeout"`
+	// MaxIdleConns 最大空闲连接数
+	MaxIdleConns int `json:"maxIdleConns" yaml:"maxIdleConns"`
+	// MaxIdleConnsPerHost 每个host最大空闲连接数
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost" yaml:"maxIdleConnsPerHost"`
+	// MaxConnsPerHost 每个host最大连接数, 0 不限制
+	MaxConnsPerHost int `json:"maxConnsPerHost" yaml:"maxConnsPerHost"`
+	// DisableHTTP2 不使用HTTP/2, 默认对https尝试HTTP/2
+	DisableHTTP2 bool `json:"disableHttp2" yaml:"disableHttp2"`
+	// Proxy 代理地址, "env" 使用环境变量, 空不使用代理
+	Proxy string `json:"proxy" yaml:"proxy"`
+	// TLS 配置, 用于Secure类型
+	TLS *TLSConf `json:"tls" yaml:"tls"`
+}
+
+// TLSConf 客户端TLS配置
+type TLSConf struct {
+	// CertFile 客户端证书
+	CertFile string `json:"certFile" yaml:"certFile"`
+	// KeyFile 客户端私钥
+	KeyFile string `json:"keyFile" yaml:"keyFile"`
+	// CAFile 自定义CA证书
+	CAFile string `json:"caFile" yaml:"caFile"`
+	// ServerName 校验的服务端域名
+	ServerName string `json:"serverName" yaml:"serverName"`
+	// InsecureSkipVerify 不校验服务端证书
+	InsecureSkipVerify bool `json:"insecureSkipVerify" yaml:"insecureSkipVerify"`
+}
+
+// HedgeConf 对冲请求策略, 仅用于GET等幂等请求
+type HedgeConf struct {
+	// Delay 发出对冲请求前的等待时间, Percentile > 0 时作为初始值
+	Delay time.Duration `json:"delay" yaml:"delay"`
+	// Percentile 按最近请求耗时的分位数计算等待时间, 如 0.95
+	Percentile float64 `json:"percentile" yaml:"percentile"`
+	// MinDelay 按分位数计算的等待时间下限
+	MinDelay time.Duration `json:"minDelay" yaml:"minDelay"`
+}
+
+// LimitConf 限流策略
+type LimitConf struct {
+	// QPS 每秒请求数, 0 不限制
+	QPS float64 `json:"qps" yaml:"qps"`
+	// Burst 令牌桶容量, 默认为 QPS
+	Burst int `json:"burst" yaml:"burst"`
+	// MaxInflight 最大并发请求数, 0 不限制
+	MaxInflight int `json:"maxInflight" yaml:"maxInflight"`
+	// Wait 超过限制时等待, 否则立即失败, 等待不会超过ctx的deadline
+	Wait bool `json:"wait" yaml:"wait"`
+}
+
+// CacheConf GET响应缓存策略
+type CacheConf struct {
+	// Store 缓存存储的名字, 需先注册, 默认为按服务的进程内LRU
+	Store string `json:"store" yaml:"store"`
+	// Size 进程内LRU的容量
+	Size int `json:"size" yaml:"size"`
+	// TTL 响应没有Cache-Control时的缓存时间, 0 不缓存
+	TTL time.Duration `json:"ttl" yaml:"ttl"`
+	// MaxStale 过期后保留用于ETag重新验证的时间
+	MaxStale time.Duration `json:"maxStale" yaml:"maxStale"`
+	// Headers 参与缓存key的请求头
+	Headers []string `json:"headers" yaml:"headers"`
+}
+
+// CompressConf 请求体压缩策略, 响应总是按Content-Encoding解压
+type CompressConf struct {
+	// Encoding 压缩算法, gzip 或 zstd, 默认gzip
+	Encoding string `json:"encoding" yaml:"encoding"`
+	// MinSize 压缩的请求体最小字节数
+	MinSize int `json:"minSize" yaml:"minSize"`
+}
+
+// DiscoveryConf 进程内服务发现配置
+type DiscoveryConf struct {
+	// Agent consul agent地址, 默认为本机 8500 端口
+	Agent string `json:"agent" yaml:"agent"`
+	// Tags 实例必须包含的标签
+	Tags []string `json:"tags" yaml:"tags"`
+	// Datacenter 数据中心, 默认为agent所在的
+	Datacenter string `json:"datacenter" yaml:"datacenter"`
+}
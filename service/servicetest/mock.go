@@ -0,0 +1,253 @@
+package servicetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/skyandong/util/service"
+)
+
+// Mock 服务类型, 用于 Service{Type: servicetest.Mock}
+const Mock = "mock"
+
+// ErrNoReply means no reply is set for the path
+var ErrNoReply = errors.New("no reply for the path")
+
+// HandlerFunc produces the reply of a call
+type HandlerFunc func(ctx context.Context, req, reply interface{}) error
+
+// Call recorded by the double
+type Call struct {
+	// Service called
+	Service service.Service
+	// Path called
+	Path string
+	// Req of the call
+	Req interface{}
+}
+
+// Double of services, replies are set by path
+type Double struct {
+	lock    sync.Mutex
+	replies map[string]*reply
+	calls   []Call
+}
+
+type reply struct {
+	data    interface{}
+	err     error
+	latency time.Duration
+	handler HandlerFunc
+}
+
+var (
+	overrides    = map[string]*Double{}
+	overridesMtx sync.RWMutex
+	useOnce      sync.Once
+)
+
+// New a double
+func New() *Double {
+	return &Double{replies: map[string]*reply{}}
+}
+
+// Register the double as the converter of typ, such as Mock
+func (d *Double) Register(typ string) *Double {
+	service.RegisterConverter(typ, d.call)
+	return d
+}
+
+// Override calls to the services of names with any type, including direct calls of service/http
+func (d *Double) Override(names ...string) *Double {
+	useOnce.Do(func() {
+		service.Use(intercept)
+	})
+	overridesMtx.Lock()
+	defer overridesMtx.Unlock()
+	for _, name := range names {
+		overrides[name] = d
+	}
+	return d
+}
+
+// Restore the services of names overridden
+func Restore(names ...string) {
+	overridesMtx.Lock()
+	defer overridesMtx.Unlock()
+	for _, name := range names {
+		delete(overrides, name)
+	}
+}
+
+// Reply data to path, data is copied to the reply by json,
+// []byte, json.RawMessage and string are taken as encoded
+func (d *Double) Reply(path string, data interface{}) *Double {
+	d.reply(path).data = data
+	return d
+}
+
+// Error to path
+func (d *Double) Error(path string, err error) *Double {
+	d.reply(path).err = err
+	return d
+}
+
+// Latency before replying path
+func (d *Double) Latency(path string, latency time.Duration) *Double {
+	d.reply(path).latency = latency
+	return d
+}
+
+// Handle path with fn
+func (d *Double) Handle(path string, fn HandlerFunc) *Double {
+	d.reply(path).handler = fn
+	return d
+}
+
+// Calls to path, all calls if path is empty
+func (d *Double) Calls(path string) []Call {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	calls := make([]Call, 0, len(d.calls))
+	for _, c := range d.calls {
+		if path == "" || c.Path == path {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset replies and calls
+func (d *Double) Reset() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.replies = map[string]*reply{}
+	d.calls = nil
+}
+
+// AssertCalled at least once
+func (d *Double) AssertCalled(t TestingT, path string) bool {
+	if len(d.Calls(path)) > 0 {
+		return true
+	}
+	t.Helper()
+	t.Errorf("expected call to %s, but not called", path)
+	return false
+}
+
+// AssertNotCalled at all
+func (d *Double) AssertNotCalled(t TestingT, path string) bool {
+	n := len(d.Calls(path))
+	if n == 0 {
+		return true
+	}
+	t.Helper()
+	t.Errorf("expected no call to %s, but called %d times", path, n)
+	return false
+}
+
+// AssertCalledTimes exactly n times
+func (d *Double) AssertCalledTimes(t TestingT, path string, n int) bool {
+	c := len(d.Calls(path))
+	if c == n {
+		return true
+	}
+	t.Helper()
+	t.Errorf("expected %d calls to %s, but called %d times", n, path, c)
+	return false
+}
+
+// TestingT is implemented by *testing.T and *testing.B
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+func (d *Double) reply(path string) *reply {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	r, ok := d.replies[path]
+	if !ok {
+		r = &reply{}
+		d.replies[path] = r
+	}
+	return r
+}
+
+func (d *Double) call(ctx context.Context, svc service.Service, path string, req, rsp interface{}) error {
+	d.lock.Lock()
+	d.calls = append(d.calls, Call{Service: svc, Path: path, Req: req})
+	r, ok := d.replies[path]
+	var cp reply
+	if ok {
+		cp = *r
+	}
+	d.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoReply, path)
+	}
+
+	if cp.latency > 0 {
+		t := time.NewTimer(cp.latency)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if cp.handler != nil {
+		return cp.handler(ctx, req, rsp)
+	}
+	if cp.err != nil {
+		return cp.err
+	}
+	return fill(cp.data, rsp)
+}
+
+func intercept(ctx context.Context, svc service.Service, path string, req, reply interface{}, next service.CallFunc) error {
+	overridesMtx.RLock()
+	d, ok := overrides[svc.Name]
+	overridesMtx.RUnlock()
+	if !ok {
+		return next(ctx, svc, path, req, reply)
+	}
+	return d.call(ctx, svc, path, req, reply)
+}
+
+// fill the reply with data, supports *[]byte and *io.ReadCloser of service/http
+func fill(data, reply interface{}) (err error) {
+	if data == nil || reply == nil {
+		return nil
+	}
+	var raw []byte
+	switch v := data.(type) {
+	case []byte:
+		raw = v
+	case json.RawMessage:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		raw, err = json.Marshal(data)
+		if err != nil {
+			return
+		}
+	}
+	switch r := reply.(type) {
+	case *[]byte:
+		*r = raw
+		return nil
+	case *io.ReadCloser:
+		*r = ioutil.NopCloser(bytes.NewReader(raw))
+		return nil
+	}
+	return json.Unmarshal(raw, reply)
+}
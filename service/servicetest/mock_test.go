@@ -0,0 +1,51 @@
+package servicetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/skyandong/util/service"
+	"github.com/skyandong/util/service/http"
+)
+
+func TestDouble_Register(t *testing.T) {
+	require := require.New(t)
+	d := New().Register(Mock).
+		Reply("/user", map[string]string{"name": "sky"}).
+		Error("/fail", errors.New("fail")).
+		Latency("/slow", time.Second)
+	svc := service.Service{Type: Mock, Name: "user"}
+	ctx := context.Background()
+
+	var reply struct {
+		Name string `json:"name"`
+	}
+	require.NoError(svc.Call(ctx, "/user", map[string]int{"id": 1}, &reply))
+	require.Equal("sky", reply.Name)
+	require.EqualError(svc.Call(ctx, "/fail", nil, &reply), "fail")
+	require.True(errors.Is(svc.Call(ctx, "/none", nil, &reply), ErrNoReply))
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	require.Equal(context.DeadlineExceeded, svc.Call(ctx, "/slow", nil, &reply))
+
+	d.AssertCalledTimes(t, "/user", 1)
+	d.AssertNotCalled(t, "/other")
+	require.Equal(map[string]int{"id": 1}, d.Calls("/user")[0].Req)
+}
+
+func TestDouble_Override(t *testing.T) {
+	require := require.New(t)
+	d := New().Override("config").Reply("/get", `{"k":"v"}`)
+	defer Restore("config")
+
+	s := http.Service{Type: http.Origin, Name: "config"}
+	data, err := s.GetJSON(context.Background(), "/get")
+	require.NoError(err)
+	require.Equal(`{"k":"v"}`, string(data))
+	d.AssertCalled(t, "/get")
+}